@@ -0,0 +1,89 @@
+// Package events passes on what happens in the plugin, such as polls and deliveries, to the config pages showing it live.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+)
+
+// Kinds of events.
+const (
+	LogEntry   = "log"
+	PollStart  = "poll-start"
+	PollFinish = "poll-finish"
+	Delivered  = "delivered"
+	Health     = "health"
+	// An item was delivered to a target of a feed, or failed to be.
+	Forwarded = "forwarded"
+)
+
+// Number of events a subscriber may fall behind by before it misses events.
+const bufferSize = 64
+
+// Event is something that happened.
+type Event struct {
+	Kind string
+	Time time.Time
+	// Set when the event is about a feed.
+	HasFeed bool
+	FeedID  int
+	// Such as the message of a log entry, the title of a delivered item, a health status or the name of a target.
+	Detail string
+	// The entry of a log event, so that it can be shown without reading the log again.
+	Entry *logging.Entry
+}
+
+// About returns an event about a feed.
+func About(kind string, feedID int, detail string) Event {
+	return Event{Kind: kind, Time: time.Now(), HasFeed: true, FeedID: feedID, Detail: detail}
+}
+
+// Broker passes every published event on to every subscriber. A subscriber that falls behind misses events
+// rather than holding up whatever published them.
+type Broker struct {
+	lock        sync.Mutex
+	subscribers map[chan Event]bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: map[chan Event]bool{}}
+}
+
+// Publish passes the event on. Does nothing on a nil broker so that publishing can be left unset.
+func (broker *Broker) Publish(event Event) {
+	if broker == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	for subscriber := range broker.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on and a function ending the subscription,
+// which closes the channel.
+func (broker *Broker) Subscribe() (<-chan Event, func()) {
+	var subscriber = make(chan Event, bufferSize)
+	broker.lock.Lock()
+	broker.subscribers[subscriber] = true
+	broker.lock.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			broker.lock.Lock()
+			delete(broker.subscribers, subscriber)
+			broker.lock.Unlock()
+			close(subscriber)
+		})
+	}
+}
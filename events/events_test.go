@@ -0,0 +1,38 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	var broker = NewBroker()
+	first, unsubscribeFirst := broker.Subscribe()
+	second, unsubscribeSecond := broker.Subscribe()
+	defer unsubscribeSecond()
+
+	broker.Publish(About(PollStart, 0, "https://example.com/feed"))
+	var event = <-first
+	assert.Equal(t, PollStart, event.Kind)
+	assert.True(t, event.HasFeed)
+	assert.Equal(t, 0, event.FeedID)
+	assert.Equal(t, "https://example.com/feed", event.Detail)
+	assert.False(t, event.Time.IsZero())
+	assert.Equal(t, event, <-second)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, open := <-first
+	assert.False(t, open)
+
+	// A subscriber that falls behind misses events instead of holding up the publisher.
+	for index := 0; index < bufferSize+10; index++ {
+		broker.Publish(Event{Kind: LogEntry})
+	}
+	assert.Len(t, second, bufferSize)
+	assert.False(t, (<-second).Time.IsZero())
+
+	var unset *Broker
+	unset.Publish(Event{Kind: LogEntry})
+}
@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 
@@ -16,7 +16,7 @@ import (
 type GotifyApi struct {
 	serverUrl    string
 	client_token string
-	logger       *log.Logger
+	logger       *slog.Logger
 }
 
 type GotifyServerInfo struct {
@@ -37,14 +37,18 @@ type GotifyApplication struct {
 }
 
 func SetupGotifyApi(serverUrl string, token string) GotifyApi {
-	return GotifyApi{serverUrl: serverUrl, client_token: token, logger: log.Default()}
+	return GotifyApi{serverUrl: serverUrl, client_token: token, logger: slog.Default()}
 }
 
-func SetupGotifyApiExternalLog(serverUrl string, token string, logger *log.Logger) GotifyApi {
+func SetupGotifyApiExternalLog(serverUrl string, token string, logger *slog.Logger) GotifyApi {
 	return GotifyApi{serverUrl: serverUrl, client_token: token, logger: logger}
 }
 
 func (server *GotifyApi) request(path string, method string, reqBody []byte) ([]byte, error) {
+	return server.requestWithToken(path, method, server.client_token, reqBody)
+}
+
+func (server *GotifyApi) requestWithToken(path string, method string, token string, reqBody []byte) ([]byte, error) {
 	var body []byte
 	versionURL, err := url.Parse(server.serverUrl)
 	if err != nil {
@@ -62,7 +66,7 @@ func (server *GotifyApi) request(path string, method string, reqBody []byte) ([]
 	if err != nil {
 		return body, err
 	}
-	req.Header.Set("X-Gotify-Key", server.client_token)
+	req.Header.Set("X-Gotify-Key", token)
 	if reader != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -218,13 +222,13 @@ type GotifyClientInfo struct {
 func (server *GotifyApi) FindClientFromToken(token string) GotifyClientInfo {
 	body, err := server.request("/client", http.MethodGet, nil)
 	if err != nil {
-		server.logger.Println(err)
+		server.logger.Error("Gotify API request failed", "error", err)
 		return GotifyClientInfo{}
 	}
 	var clients []GotifyClientInfo
 	err = json.Unmarshal(body, &clients)
 	if err != nil {
-		server.logger.Println(err)
+		server.logger.Error("Gotify API request failed", "error", err)
 		return GotifyClientInfo{}
 	}
 
@@ -240,7 +244,7 @@ func (server *GotifyApi) FindClientFromToken(token string) GotifyClientInfo {
 func (server *GotifyApi) DeleteClient(id int) {
 	_, err := server.request(fmt.Sprintf("/client/%d", id), http.MethodDelete, nil)
 	if err != nil {
-		server.logger.Println(err)
+		server.logger.Error("Gotify API request failed", "error", err)
 		return
 	}
 }
@@ -268,3 +272,25 @@ func (server *GotifyApi) CreateClient(name string) (GotifyClientInfo, error) {
 
 	return client, nil
 }
+
+type GotifyMessage struct {
+	Id       int    `json:"id,omitempty"`
+	Title    string `json:"title"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// Sends a message as the application the token belongs to. Returns the message as created by Gotify.
+func (server *GotifyApi) SendMessage(appToken string, message GotifyMessage) (GotifyMessage, error) {
+	var sent GotifyMessage
+	reqBody, err := json.Marshal(message)
+	if err != nil {
+		return sent, err
+	}
+	body, err := server.requestWithToken("/message", http.MethodPost, appToken, reqBody)
+	if err != nil {
+		return sent, err
+	}
+	err = json.Unmarshal(body, &sent)
+	return sent, err
+}
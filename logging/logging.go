@@ -0,0 +1,194 @@
+// Package logging keeps the log of the plugin in a bounded in-memory ring buffer so it can be browsed from the config page.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Key of the attribute naming the feed an entry is about.
+const FeedKey = "feed"
+
+// Number of entries kept when no size is given.
+const DefaultSize = 1000
+
+// Feed returns the attribute naming the feed an entry is about.
+func Feed(id int) slog.Attr {
+	return slog.Int(FeedKey, id)
+}
+
+// Entry is a single logged record.
+type Entry struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	// Set when the entry is about a feed.
+	HasFeed bool
+	FeedID  int
+	Attrs   []slog.Attr
+}
+
+// Filter selects entries of a Ring. The zero value selects every entry.
+type Filter struct {
+	// Entries below this level are left out.
+	Level slog.Level
+	// Only entries of this feed when set.
+	FeedID *int
+	// Only entries logged after this time when not zero.
+	Since time.Time
+}
+
+// Matches reports whether the entry is selected by the filter.
+func (filter Filter) Matches(entry Entry) bool {
+	if entry.Level < filter.Level {
+		return false
+	}
+	if filter.FeedID != nil && (!entry.HasFeed || entry.FeedID != *filter.FeedID) {
+		return false
+	}
+	return filter.Since.IsZero() || entry.Time.After(filter.Since)
+}
+
+// Ring keeps the latest entries up to a fixed size, dropping the oldest.
+type Ring struct {
+	lock     sync.Mutex
+	entries  []Entry
+	next     int
+	full     bool
+	listener func(Entry)
+}
+
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Ring{entries: make([]Entry, size)}
+}
+
+// Size returns the number of entries the ring keeps.
+func (ring *Ring) Size() int {
+	return len(ring.entries)
+}
+
+// OnAdd sets a function called with every entry added from now on, such as to show entries live.
+func (ring *Ring) OnAdd(listener func(Entry)) {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	ring.listener = listener
+}
+
+func (ring *Ring) add(entry Entry) {
+	ring.lock.Lock()
+	ring.entries[ring.next] = entry
+	ring.next = (ring.next + 1) % len(ring.entries)
+	if ring.next == 0 {
+		ring.full = true
+	}
+	var listener = ring.listener
+	ring.lock.Unlock()
+	if listener != nil {
+		listener(entry)
+	}
+}
+
+// Entries returns the kept entries selected by the filter, oldest first.
+func (ring *Ring) Entries(filter Filter) []Entry {
+	ring.lock.Lock()
+	defer ring.lock.Unlock()
+	var ordered = ring.entries[:ring.next]
+	if ring.full {
+		ordered = append(slices.Clone(ring.entries[ring.next:]), ordered...)
+	}
+	var selected []Entry
+	for _, entry := range ordered {
+		if filter.Matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// Handler is a slog.Handler adding every record to a Ring and passing it on to another handler.
+type Handler struct {
+	ring  *Ring
+	next  slog.Handler
+	level slog.Leveler
+	attrs []slog.Attr
+	group string
+}
+
+// NewHandler adds records of at least the given level to the ring. Records are also passed to next when it is not nil.
+func NewHandler(ring *Ring, next slog.Handler, level slog.Leveler) *Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &Handler{ring: ring, next: next, level: level}
+}
+
+func (handler *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= handler.level.Level()
+}
+
+func (handler *Handler) Handle(ctx context.Context, record slog.Record) error {
+	var entry = Entry{Time: record.Time, Level: record.Level, Message: record.Message}
+	var collect = func(attr slog.Attr) {
+		if attr.Key == FeedKey && attr.Value.Kind() == slog.KindInt64 {
+			entry.HasFeed = true
+			entry.FeedID = int(attr.Value.Int64())
+			return
+		}
+		entry.Attrs = append(entry.Attrs, attr)
+	}
+	for _, attr := range handler.attrs {
+		collect(attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		collect(handler.qualify(attr))
+		return true
+	})
+	handler.ring.add(entry)
+
+	if handler.next != nil && handler.next.Enabled(ctx, record.Level) {
+		return handler.next.Handle(ctx, record)
+	}
+	return nil
+}
+
+func (handler *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var copied = *handler
+	copied.attrs = slices.Clone(handler.attrs)
+	for _, attr := range attrs {
+		copied.attrs = append(copied.attrs, handler.qualify(attr))
+	}
+	if handler.next != nil {
+		copied.next = handler.next.WithAttrs(attrs)
+	}
+	return &copied
+}
+
+// Prefixes the key of the attribute with the open groups.
+func (handler *Handler) qualify(attr slog.Attr) slog.Attr {
+	if len(handler.group) != 0 {
+		attr.Key = handler.group + "." + attr.Key
+	}
+	return attr
+}
+
+func (handler *Handler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return handler
+	}
+	var copied = *handler
+	if len(copied.group) != 0 {
+		copied.group += "." + name
+	} else {
+		copied.group = name
+	}
+	if handler.next != nil {
+		copied.next = handler.next.WithGroup(name)
+	}
+	return &copied
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingDropsOldest(t *testing.T) {
+	var ring = NewRing(3)
+	var logger = slog.New(NewHandler(ring, nil, slog.LevelDebug))
+	for index := 1; index <= 5; index++ {
+		logger.Info(fmt.Sprintf("entry %d", index))
+	}
+
+	var entries = ring.Entries(Filter{Level: slog.LevelDebug})
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "entry 3", entries[0].Message)
+	assert.Equal(t, "entry 5", entries[2].Message)
+}
+
+func TestRingCallsListener(t *testing.T) {
+	var ring = NewRing(2)
+	var logger = slog.New(NewHandler(ring, nil, slog.LevelDebug))
+	logger.Info("before")
+	var added = []string{}
+	ring.OnAdd(func(entry Entry) {
+		added = append(added, entry.Message)
+	})
+	logger.Info("after", Feed(3))
+	assert.Equal(t, []string{"after"}, added)
+}
+
+func TestHandlerKeepsFeedAndPassesOn(t *testing.T) {
+	var ring = NewRing(10)
+	var output = new(bytes.Buffer)
+	var next = slog.NewTextHandler(output, &slog.HandlerOptions{Level: slog.LevelInfo})
+	var logger = slog.New(NewHandler(ring, next, slog.LevelDebug))
+
+	logger.Debug("Polled feed", Feed(4), "new", 2)
+	logger.With(Feed(7)).Warn("Failed to parse", "url", "https://example.com")
+
+	var entries = ring.Entries(Filter{Level: slog.LevelDebug})
+	assert.Len(t, entries, 2)
+	assert.True(t, entries[0].HasFeed)
+	assert.Equal(t, 4, entries[0].FeedID)
+	assert.Equal(t, []slog.Attr{slog.Int("new", 2)}, entries[0].Attrs)
+	assert.Equal(t, 7, entries[1].FeedID)
+	// Debug entries are only kept in the ring.
+	assert.NotContains(t, output.String(), "Polled feed")
+	assert.Contains(t, output.String(), "feed=7")
+}
+
+func TestFilter(t *testing.T) {
+	var now = time.Now()
+	var entry = Entry{Time: now, Level: slog.LevelInfo, HasFeed: true, FeedID: 0}
+	var first, second = 0, 1
+	assert.True(t, Filter{}.Matches(entry))
+	assert.False(t, Filter{Level: slog.LevelWarn}.Matches(entry))
+	assert.True(t, Filter{FeedID: &first}.Matches(entry))
+	assert.False(t, Filter{FeedID: &second}.Matches(entry))
+	assert.True(t, Filter{Since: now.Add(-time.Minute)}.Matches(entry))
+	assert.False(t, Filter{Since: now}.Matches(entry))
+	assert.False(t, Filter{FeedID: &first}.Matches(Entry{Time: now, Level: slog.LevelInfo}))
+}
@@ -0,0 +1,132 @@
+// Package opml reads and writes subscription lists in the OPML 2.0 format.
+package opml
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+)
+
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    Head     `xml:"head"`
+	Body    Body     `xml:"body"`
+}
+
+type Head struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type Body struct {
+	Outlines []Outline `xml:"outline"`
+}
+
+type Outline struct {
+	Text     string    `xml:"text,attr"`
+	Title    string    `xml:"title,attr,omitempty"`
+	Type     string    `xml:"type,attr,omitempty"`
+	XMLURL   string    `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string    `xml:"htmlUrl,attr,omitempty"`
+	Category string    `xml:"category,attr,omitempty"`
+	Outlines []Outline `xml:"outline"`
+}
+
+// A single feed within an OPML document.
+type Subscription struct {
+	Url     string
+	Title   string
+	SiteUrl string
+	// Name of the outline the feed is nested in. Empty for top level feeds.
+	Group string
+	Tags  []string
+}
+
+// Encode writes the subscriptions as an OPML document. Subscriptions with a group are nested in an outline named after it.
+func Encode(title string, subscriptions []Subscription) ([]byte, error) {
+	var document = OPML{Version: "2.0", Head: Head{Title: title, DateCreated: time.Now().Format(time.RFC1123Z)}}
+
+	var groups = map[string]int{}
+	for _, subscription := range subscriptions {
+		var outline = Outline{
+			Text:    subscription.Title,
+			Title:   subscription.Title,
+			Type:    "rss",
+			XMLURL:  subscription.Url,
+			HTMLURL: subscription.SiteUrl,
+		}
+		if len(outline.Text) == 0 {
+			outline.Text = subscription.Url
+		}
+		var categories = []string{}
+		for _, tag := range subscription.Tags {
+			categories = append(categories, "/"+tag)
+		}
+		outline.Category = strings.Join(categories, ",")
+
+		if len(subscription.Group) == 0 {
+			document.Body.Outlines = append(document.Body.Outlines, outline)
+			continue
+		}
+		index, present := groups[subscription.Group]
+		if !present {
+			index = len(document.Body.Outlines)
+			groups[subscription.Group] = index
+			document.Body.Outlines = append(document.Body.Outlines, Outline{Text: subscription.Group, Title: subscription.Group})
+		}
+		document.Body.Outlines[index].Outlines = append(document.Body.Outlines[index].Outlines, outline)
+	}
+
+	output, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), output...), nil
+}
+
+// Decode reads every feed from an OPML document. Nested outlines are flattened, using the outermost outline as the group.
+func Decode(data []byte) ([]Subscription, error) {
+	var document OPML
+	err := xml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+	if document.XMLName.Local != "opml" {
+		return nil, errors.New("not an OPML document")
+	}
+
+	var subscriptions = []Subscription{}
+	for _, outline := range document.Body.Outlines {
+		subscriptions = collect(subscriptions, outline, "")
+	}
+	return subscriptions, nil
+}
+
+func collect(subscriptions []Subscription, outline Outline, group string) []Subscription {
+	if len(outline.XMLURL) != 0 {
+		var subscription = Subscription{Url: strings.TrimSpace(outline.XMLURL), Title: outline.Title, SiteUrl: outline.HTMLURL, Group: group}
+		if len(subscription.Title) == 0 {
+			subscription.Title = outline.Text
+		}
+		for _, category := range strings.Split(outline.Category, ",") {
+			var tag = strings.Trim(strings.TrimSpace(category), "/")
+			if len(tag) != 0 {
+				subscription.Tags = append(subscription.Tags, tag)
+			}
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if len(group) == 0 && len(outline.XMLURL) == 0 {
+		group = outline.Text
+		if len(group) == 0 {
+			group = outline.Title
+		}
+	}
+	for _, child := range outline.Outlines {
+		subscriptions = collect(subscriptions, child, group)
+	}
+	return subscriptions
+}
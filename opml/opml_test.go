@@ -0,0 +1,53 @@
+package opml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var subscriptions = []Subscription{
+		{Url: "https://example.com/feed.xml", Title: "Example", SiteUrl: "https://example.com"},
+		{Url: "https://news.example.org/rss", Title: "News", Group: "Daily", Tags: []string{"news", "world"}},
+		{Url: "https://weather.example.org/atom", Group: "Daily"},
+	}
+
+	encoded, err := Encode("Simple Feeds", subscriptions)
+	assert.NoError(t, err)
+
+	decoded, err := Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, []Subscription{
+		subscriptions[0],
+		subscriptions[1],
+		{Url: "https://weather.example.org/atom", Title: "https://weather.example.org/atom", Group: "Daily"},
+	}, decoded)
+}
+
+func TestDecodeNested(t *testing.T) {
+	var document = `<?xml version="1.0"?>
+<opml version="1.0">
+  <head><title>Export</title></head>
+  <body>
+    <outline text="Tech">
+      <outline text="Blogs">
+        <outline text="A Blog" xmlUrl=" https://blog.example.com/feed " category="/dev,/go"/>
+      </outline>
+    </outline>
+    <outline text="Loose" type="rss" xmlUrl="https://loose.example.com/rss"/>
+  </body>
+</opml>`
+
+	decoded, err := Decode([]byte(document))
+	assert.NoError(t, err)
+	assert.Equal(t, []Subscription{
+		{Url: "https://blog.example.com/feed", Title: "A Blog", Group: "Tech", Tags: []string{"dev", "go"}},
+		{Url: "https://loose.example.com/rss", Title: "Loose"},
+	}, decoded)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	_, err := Decode([]byte("<rss></rss>"))
+	assert.Error(t, err)
+}
@@ -1,16 +1,18 @@
 package main
 
 import (
-	"bytes"
 	_ "embed"
-	"io"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/CEKlopfenstein/simple-feeds/config"
+	"github.com/CEKlopfenstein/simple-feeds/events"
 	"github.com/CEKlopfenstein/simple-feeds/gotify_api"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
 	"github.com/CEKlopfenstein/simple-feeds/rssreader"
 	"github.com/CEKlopfenstein/simple-feeds/storage"
 	"github.com/CEKlopfenstein/simple-feeds/structs"
@@ -50,8 +52,9 @@ type GotifyRSSPlugin struct {
 	hostName   string
 	storage    storage.Storage
 	enabled    bool
-	logger     *log.Logger
-	logBuffer  *bytes.Buffer
+	logger     *slog.Logger
+	logRing    *logging.Ring
+	events     *events.Broker
 	msgHandler plugin.MessageHandler
 	cronJobs   *cron.Cron
 }
@@ -62,13 +65,12 @@ func (c *GotifyRSSPlugin) Enable() error {
 	var server = gotify_api.SetupGotifyApiExternalLog(c.hostName, c.storage.GetClientToken(), c.logger)
 	c.rssreader.SetUserName(c.userCtx.Name)
 	c.rssreader.SetGotifyApi(server)
-	c.rssreader.SetLogger(c.logger)
-	c.rssreader.SetStorage(c.storage)
-	c.logger.Printf("Plugin Enabled for %s\n", c.userCtx.Name)
-	c.rssreader.CheckFeeds(c.msgHandler)
+	c.rssreader.SetMessageHandler(c.msgHandler)
+	c.logger.Info("Plugin Enabled", "user", c.userCtx.Name)
+	c.rssreader.CheckFeeds()
 
 	c.cronJobs = cron.New()
-	c.cronJobs.AddFunc("0 */5 * * * *", func() { c.rssreader.CheckFeeds(c.msgHandler) })
+	c.cronJobs.AddFunc("0 * * * * *", func() { c.rssreader.CheckFeeds() })
 	c.cronJobs.Start()
 	return nil
 }
@@ -78,7 +80,12 @@ func (c *GotifyRSSPlugin) Disable() error {
 	c.enabled = false
 	c.cronJobs.Stop()
 	c.cronJobs = nil
-	c.logger.Printf("Plugin Disabled for %s\n", c.userCtx.Name)
+	// Items still waiting to be sent are recorded as failed before saving.
+	c.rssreader.Stop()
+	if err := c.storage.Flush(); err != nil {
+		c.logger.Error("Failed to save before disabling", "error", err)
+	}
+	c.logger.Info("Plugin Disabled", "user", c.userCtx.Name)
 	return nil
 }
 
@@ -87,10 +94,20 @@ func (c *GotifyRSSPlugin) GetDisplay(location *url.URL) string {
 
 	toReturn += "## Version: " + info.Version + "\n\n## Description:\n" + info.Description + "\n\n"
 
+	if err := c.storage.Error(); err != nil {
+		toReturn += "## Storage Error\n\n" + err.Error() + "\n\nChanges will not be saved until this is resolved.\n\n"
+	}
+
 	if len(c.storage.GetClientToken()) == 0 {
 		toReturn += "Missing Token. Go to Config Page to setup.\n\n"
 	}
 
+	var stats = c.storage.GetTotalStats()
+	var now = time.Now()
+	toReturn += "## Statistics\n\n" +
+		"Today: " + statsSummary(storage.StatsSince(stats, now)) + "\n\n" +
+		"Last 7 days: " + statsSummary(storage.StatsSince(stats, now.AddDate(0, 0, -6))) + "\n\n"
+
 	toReturn += "## [Config Page](" + c.basePath + ")"
 	if !c.enabled {
 		toReturn += " is only accessible if plugin is enabled.\n\n"
@@ -101,13 +118,18 @@ func (c *GotifyRSSPlugin) GetDisplay(location *url.URL) string {
 	return toReturn
 }
 
+func statsSummary(stats storage.DailyStats) string {
+	return fmt.Sprintf("%d polls, %d new items, %d delivered, %d errors.", stats.Polls, stats.NewItems, stats.Delivered, stats.ParseErrors)
+}
+
 func (c *GotifyRSSPlugin) RegisterWebhook(basePath string, mux *gin.RouterGroup) {
 	c.basePath = basePath
-	user_interface.BuildInterface(basePath, mux, &c.rssreader, c.config, c.hostName, c.logger, c.logBuffer)
+	user_interface.BuildInterface(basePath, mux, &c.rssreader, c.config, c.hostName, c.logger, c.logRing, c.events)
 }
 
 func (c *GotifyRSSPlugin) SetStorageHandler(h plugin.StorageHandler) {
-	c.storage.StorageHandler = h
+	c.storage = storage.NewGotifyStorage(h, c.logger)
+	c.rssreader.SetStorage(c.storage)
 }
 
 func (c *GotifyRSSPlugin) SetMessageHandler(h plugin.MessageHandler) {
@@ -137,12 +159,21 @@ func NewGotifyPluginInstance(ctx plugin.UserContext) plugin.Plugin {
 		host += ":" + strconv.Itoa(conf.Server.Port)
 	}
 
-	logBuffer := &(bytes.Buffer{})
-	logger := log.New(io.MultiWriter(os.Stdout, logBuffer), "Gotify RSS: ", log.LstdFlags|log.Lmsgprefix)
-	logger.Printf("Logger Successfully Created for %s", ctx.Name)
-
-	toReturn := &GotifyRSSPlugin{userCtx: ctx, hostName: host, logger: logger, logBuffer: logBuffer}
-	toReturn.storage.Logger = logger
+	// Debug entries are only kept for the config page.
+	logRing := logging.NewRing(logging.DefaultSize)
+	stdout := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}).WithAttrs([]slog.Attr{slog.String("plugin", "Gotify RSS")})
+	logger := slog.New(logging.NewHandler(logRing, stdout, slog.LevelDebug))
+	logger.Info("Logger Successfully Created", "user", ctx.Name)
+
+	// Log entries and polls are passed on to the config pages that are open.
+	broker := events.NewBroker()
+	logRing.OnAdd(func(entry logging.Entry) {
+		broker.Publish(events.Event{Kind: events.LogEntry, Time: entry.Time, HasFeed: entry.HasFeed, FeedID: entry.FeedID, Detail: entry.Message, Entry: &entry})
+	})
+
+	toReturn := &GotifyRSSPlugin{userCtx: ctx, hostName: host, logger: logger, logRing: logRing, events: broker}
+	toReturn.rssreader.SetLogger(logger)
+	toReturn.rssreader.SetEvents(broker)
 
 	return toReturn
 }
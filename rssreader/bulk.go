@@ -0,0 +1,77 @@
+package rssreader
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+)
+
+// A change of a feed's URL made by a find and replace.
+type UrlChange struct {
+	ID   int
+	Name string
+	From string
+	To   string
+}
+
+// PlanUrlReplace works out the URLs of the given feeds after replacing every find with replace, without changing anything.
+// Feeds whose URL does not contain find are left out. Fails when a new URL is invalid or would be subscribed twice.
+func (rssreader *RSS_Reader) PlanUrlReplace(ids []int, find string, replace string) ([]UrlChange, error) {
+	if len(find) == 0 {
+		return nil, errors.New("nothing to find")
+	}
+	var feeds = rssreader.Storage.GetFeeds()
+	var changes = []UrlChange{}
+	var moving = map[int]bool{}
+	for _, id := range ids {
+		var feed = feeds[id]
+		if feed == nil {
+			return nil, fmt.Errorf("feed %d: %w", id, storage.ErrFeedNotFound)
+		}
+		// Webhook feeds have no URL to replace in.
+		if moving[id] || feed.Webhook != nil || !strings.Contains(feed.Url, find) {
+			continue
+		}
+		var change = UrlChange{ID: id, Name: feed.Name(), From: feed.Url, To: strings.ReplaceAll(feed.Url, find, replace)}
+		if err := ValidateURL(change.To); err != nil {
+			return nil, fmt.Errorf("%s: %w", change.Name, err)
+		}
+		moving[id] = true
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+
+	var owners = map[string][]string{}
+	for id, feed := range feeds {
+		if !moving[id] && feed.Webhook == nil {
+			owners[feed.Url] = append(owners[feed.Url], feed.Name())
+		}
+	}
+	for _, change := range changes {
+		owners[change.To] = append(owners[change.To], change.Name)
+		if len(owners[change.To]) > 1 {
+			return nil, fmt.Errorf("%s would be the URL of both %s", change.To, strings.Join(owners[change.To], " and "))
+		}
+	}
+	return changes, nil
+}
+
+// ReplaceFeedUrls applies a find and replace to the URLs of the given feeds at once, keeping what has been seen from them.
+// Meant for a site moving hosts, so the new URLs are not fetched until the next poll.
+func (rssreader *RSS_Reader) ReplaceFeedUrls(ids []int, find string, replace string) ([]UrlChange, error) {
+	changes, err := rssreader.PlanUrlReplace(ids, find, replace)
+	if err != nil {
+		return nil, err
+	}
+	var urls = map[int]string{}
+	for _, change := range changes {
+		urls[change.ID] = change.To
+	}
+	if len(urls) == 0 {
+		return changes, nil
+	}
+	return changes, rssreader.Storage.SaveFeedUrls(urls)
+}
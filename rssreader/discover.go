@@ -0,0 +1,135 @@
+package rssreader
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+)
+
+// Types of the feeds a page can link to with <link rel="alternate">.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// Paths commonly serving the feed of a site. Probed from the root of the site.
+var commonFeedPaths = []string{"/feed", "/rss", "/feed.xml", "/rss.xml", "/atom.xml", "/index.xml", "/feed.json"}
+
+// A feed found for a web page.
+type FeedCandidate struct {
+	Url   string
+	Title string
+	// How the feed was found. "link" when the page links to it, "probe" when found at a common path.
+	Source string
+}
+
+var discoveryClient = &http.Client{Timeout: 15 * time.Second}
+
+// DiscoverFeeds finds the feeds of the web page at pageUrl. The page's alternate links are read first,
+// then the common feed paths of the site are probed. Linked feeds are offered without being fetched.
+// The common paths are probed even when the page cannot be fetched, whose error is only returned when nothing is found.
+func DiscoverFeeds(pageUrl string) ([]FeedCandidate, error) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	var candidates = []FeedCandidate{}
+	var seen = map[string]bool{}
+
+	linked, pageError := linkedFeeds(base)
+	for _, candidate := range linked {
+		if !seen[candidate.Url] {
+			seen[candidate.Url] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	var probes = make([]*FeedCandidate, len(commonFeedPaths))
+	var wait sync.WaitGroup
+	for index, path := range commonFeedPaths {
+		var probeUrl = base.ResolveReference(&url.URL{Path: path}).String()
+		if seen[probeUrl] {
+			continue
+		}
+		wait.Add(1)
+		go func(index int, probeUrl string) {
+			defer wait.Done()
+			probes[index] = probeFeed(probeUrl)
+		}(index, probeUrl)
+	}
+	wait.Wait()
+	for _, probe := range probes {
+		if probe != nil && !seen[probe.Url] {
+			seen[probe.Url] = true
+			candidates = append(candidates, *probe)
+		}
+	}
+	if len(candidates) == 0 && pageError != nil {
+		return nil, pageError
+	}
+	return candidates, nil
+}
+
+// Reads the feeds linked from the head of the page.
+func linkedFeeds(base *url.URL) ([]FeedCandidate, error) {
+	request, err := http.NewRequest(http.MethodGet, base.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, body, err := fetchLimited(discoveryClient, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", base, response.Status)
+	}
+	document, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if href, present := document.Find("base[href]").First().Attr("href"); present {
+		if baseHref, err := base.Parse(href); err == nil {
+			base = baseHref
+		}
+	}
+
+	var candidates = []FeedCandidate{}
+	document.Find(`link[rel~="alternate"][href]`).Each(func(_ int, link *goquery.Selection) {
+		var linkType = strings.ToLower(strings.TrimSpace(link.AttrOr("type", "")))
+		if !feedLinkTypes[linkType] {
+			return
+		}
+		href, err := base.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+		if err != nil || ValidateURL(href.String()) != nil {
+			return
+		}
+		candidates = append(candidates, FeedCandidate{Url: href.String(), Title: strings.TrimSpace(link.AttrOr("title", "")), Source: "link"})
+	})
+	return candidates, nil
+}
+
+// Fetches the URL and returns it as a candidate when it serves a feed.
+func probeFeed(probeUrl string) *FeedCandidate {
+	request, err := http.NewRequest(http.MethodGet, probeUrl, nil)
+	if err != nil {
+		return nil
+	}
+	request.Header.Set("User-Agent", "Gofeed/1.0")
+	response, body, err := fetchLimited(discoveryClient, request)
+	if err != nil || response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	return &FeedCandidate{Url: probeUrl, Title: feed.Title, Source: "probe"}
+}
@@ -0,0 +1,51 @@
+package rssreader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverFeeds(t *testing.T) {
+	var feeds = testFeeds{"/rss.xml": {1}, "/blog/atom": {1}}
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/blog/" {
+			writer.Write([]byte(`<html><head>
+				<link rel="alternate" type="application/atom+xml" title="Blog" href="atom">
+				<link rel="alternate" type="text/html" href="/other">
+				<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+			</head></html>`))
+			return
+		}
+		feeds.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	candidates, err := DiscoverFeeds(server.URL + "/blog/")
+	assert.NoError(t, err)
+	assert.Equal(t, []FeedCandidate{
+		{Url: server.URL + "/blog/atom", Title: "Blog", Source: "link"},
+		{Url: server.URL + "/rss.xml", Source: "link"},
+	}, candidates)
+
+	candidates, err = DiscoverFeeds(server.URL + "/blog/atom")
+	assert.NoError(t, err)
+	assert.Equal(t, []FeedCandidate{{Url: server.URL + "/rss.xml", Title: "/rss.xml", Source: "probe"}}, candidates)
+}
+
+func TestDiscoverFeedsProbesWhenPageFails(t *testing.T) {
+	var feeds = testFeeds{"/feed": {1}}
+	var server = httptest.NewServer(feeds)
+	defer server.Close()
+
+	candidates, err := DiscoverFeeds(server.URL + "/missing")
+	assert.NoError(t, err)
+	assert.Equal(t, []FeedCandidate{{Url: server.URL + "/feed", Title: "/feed", Source: "probe"}}, candidates)
+
+	var empty = httptest.NewServer(testFeeds{})
+	defer empty.Close()
+	_, err = DiscoverFeeds(empty.URL + "/missing")
+	assert.ErrorContains(t, err, "404")
+}
@@ -0,0 +1,97 @@
+package rssreader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/mmcdole/gofeed"
+)
+
+var feedClient = &http.Client{Timeout: 30 * time.Second}
+
+// Largest feed document read, in bytes. Larger documents are reported as errors rather than read into memory whole.
+var maxFeedSize int64 = 10 << 20
+
+// The outcome of fetching a feed document.
+type fetchedFeed struct {
+	// Nil when the feed was not modified.
+	feed         *gofeed.Feed
+	notModified  bool
+	bytes        int64
+	latency      time.Duration
+	etag         string
+	lastModified string
+}
+
+// FetchFeed fetches and parses the feed at feedUrl, such as to preview it, within the same limits as a poll.
+func FetchFeed(feedUrl string) (*gofeed.Feed, error) {
+	fetched, err := fetchDocument(&storage.Feed{Url: feedUrl}, false)
+	return fetched.feed, err
+}
+
+// Sends the request with the client and reads at most maxFeedSize bytes of the answer, so that a slow or huge document
+// can neither hang the caller nor use up memory. Every fetch of a feed or web page goes through it. The body read so
+// far is returned with the error when the document is too large.
+func fetchLimited(client *http.Client, request *http.Request) (*http.Response, []byte, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxFeedSize+1))
+	if err != nil {
+		return response, body, err
+	}
+	if int64(len(body)) > maxFeedSize {
+		return response, body, fmt.Errorf("%s is larger than the limit of %d bytes", request.URL, maxFeedSize)
+	}
+	return response, body, nil
+}
+
+// Fetches and parses the feed. When conditional, the validators of the last fetch are sent so that an unchanged feed
+// answers 304 Not Modified without a body. Latency and size are filled in even when fetching fails.
+func fetchDocument(feedRecord *storage.Feed, conditional bool) (fetchedFeed, error) {
+	var result fetchedFeed
+	request, err := http.NewRequest(http.MethodGet, feedRecord.Url, nil)
+	if err != nil {
+		return result, err
+	}
+	request.Header.Set("User-Agent", "Gofeed/1.0")
+	if conditional {
+		if len(feedRecord.ETag) != 0 {
+			request.Header.Set("If-None-Match", feedRecord.ETag)
+		}
+		if len(feedRecord.LastModified) != 0 {
+			request.Header.Set("If-Modified-Since", feedRecord.LastModified)
+		}
+	}
+
+	var start = time.Now()
+	response, body, err := fetchLimited(feedClient, request)
+	result.latency = time.Since(start)
+	result.bytes = int64(len(body))
+	if err != nil {
+		return result, err
+	}
+
+	if response.StatusCode == http.StatusNotModified {
+		result.notModified = true
+		result.etag = feedRecord.ETag
+		result.lastModified = feedRecord.LastModified
+		return result, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return result, gofeed.HTTPError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+	result.feed, err = gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	result.etag = response.Header.Get("ETag")
+	result.lastModified = response.Header.Get("Last-Modified")
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package rssreader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchDocumentRejectsLargeFeeds(t *testing.T) {
+	defer func(size int64) { maxFeedSize = size }(maxFeedSize)
+	var server = httptest.NewServer(testFeeds{"/a": {3, 2, 1}})
+	defer server.Close()
+	var feedRecord = &storage.Feed{Url: server.URL + "/a"}
+
+	fetched, err := fetchDocument(feedRecord, false)
+	assert.NoError(t, err)
+	assert.Len(t, fetched.feed.Items, 3)
+
+	maxFeedSize = fetched.bytes - 1
+	fetched, err = fetchDocument(feedRecord, false)
+	assert.ErrorContains(t, err, "larger than the limit")
+	assert.Nil(t, fetched.feed)
+	assert.Equal(t, maxFeedSize+1, fetched.bytes)
+}
+
+// Serves documents larger than the lowered limit on every path.
+func oversizedServer(t *testing.T) *httptest.Server {
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Large</title>`))
+		writer.Write([]byte(strings.Repeat("<item><title>padding</title></item>", 100)))
+		writer.Write([]byte(`</channel></rss>`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEveryFetchIsLimited(t *testing.T) {
+	defer func(size int64) { maxFeedSize = size }(maxFeedSize)
+	var server = oversizedServer(t)
+	reader, _, _ := newTestReader(t, testFeeds{})
+	feed, _ := reader.Storage.SaveNewFeed(server.URL+"/feed", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+
+	_, err := FetchFeed(server.URL + "/feed")
+	assert.NoError(t, err)
+
+	maxFeedSize = 1024
+	_, err = FetchFeed(server.URL + "/feed")
+	assert.ErrorContains(t, err, "larger than the limit")
+	_, err = reader.FeedUrlEdit(feed.GetID(), server.URL+"/other")
+	assert.ErrorContains(t, err, "larger than the limit")
+	assert.ErrorContains(t, reader.RefreshMeta(feed.GetID()), "larger than the limit")
+	_, err = DiscoverFeeds(server.URL + "/page")
+	assert.Error(t, err)
+}
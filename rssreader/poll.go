@@ -0,0 +1,562 @@
+package rssreader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/events"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/gotify/plugin-api"
+	"github.com/mmcdole/gofeed"
+)
+
+// The result of fetching a single feed during a poll. Nothing is sent or saved until every feed of the poll is fetched.
+type feedPoll struct {
+	id         int
+	feedRecord *storage.Feed
+	feed       *gofeed.Feed
+	toSend     []pendingItem
+	urls       []string
+	latest     *time.Time
+	overflow   int
+	// Number of items found to be new, or to be sent under the backlog policy.
+	newCount int
+	settings storage.EffectiveSettings
+	// What happened to each new item, recorded once the poll is done.
+	deliveries  []storage.Delivery
+	pauseReason string
+	stats       storage.PollStats
+}
+
+// A new item waiting to be sent.
+type pendingItem struct {
+	feedID   int
+	item     *gofeed.Item
+	settings storage.EffectiveSettings
+	// Time used to order the item. The time of the poll when the item has no date.
+	time time.Time
+	// Position of the item counting from the bottom of the feed document.
+	order int
+}
+
+// What a poll found and did.
+type PollSummary struct {
+	Feeds     int
+	Found     int
+	New       int
+	Filtered  int
+	Deferred  int
+	Delivered int
+	// Items handed to the targets of feeds that do not send to Gotify.
+	Forwarded int
+	Failed    int
+	// Items left to send in the background once the poll returned.
+	Queued int
+	// Feeds skipped as they are paused or snoozed.
+	Skipped int
+	// Feeds that answered they had not changed since the last poll.
+	NotModified int
+	Errors      []string
+}
+
+func (summary PollSummary) String() string {
+	var text = fmt.Sprintf("Checked %d feeds: %d items found, %d new, %d filtered, %d delivered", summary.Feeds, summary.Found, summary.New, summary.Filtered, summary.Delivered)
+	if summary.Deferred != 0 {
+		text += fmt.Sprintf(", %d deferred", summary.Deferred)
+	}
+	if summary.Forwarded != 0 {
+		text += fmt.Sprintf(", %d forwarded", summary.Forwarded)
+	}
+	if summary.Failed != 0 {
+		text += fmt.Sprintf(", %d failed to send", summary.Failed)
+	}
+	if summary.Queued != 0 {
+		text += fmt.Sprintf(", %d queued to send", summary.Queued)
+	}
+	if summary.NotModified != 0 {
+		text += fmt.Sprintf(". %d feeds had not changed", summary.NotModified)
+	}
+	if summary.Skipped != 0 {
+		text += fmt.Sprintf(". Skipped %d paused or snoozed feeds", summary.Skipped)
+	}
+	return text + "."
+}
+
+// CheckFeeds polls the feeds that are due according to their poll interval. Run every minute by the cron, which is not
+// held up by the sends of the poll.
+func (rssreader *RSS_Reader) CheckFeeds() PollSummary {
+	var now = time.Now()
+	var groups = rssreader.Storage.GetGroups()
+	var settings = rssreader.Storage.GetSettings()
+	var due = []int{}
+	for id, feedRecord := range rssreader.Storage.GetFeeds() {
+		var effective = storage.ResolveSettings(feedRecord, groups[feedRecord.Group], settings)
+		if isDue(feedRecord, effective, now) {
+			due = append(due, id)
+		}
+	}
+	return rssreader.poll(rssreader.context(), due, nil, false)
+}
+
+// CheckAllNow polls every feed right away whether or not it is due, and waits for its items to be sent.
+func (rssreader *RSS_Reader) CheckAllNow() PollSummary {
+	var ids = []int{}
+	for id := range rssreader.Storage.GetFeeds() {
+		ids = append(ids, id)
+	}
+	return rssreader.poll(rssreader.context(), ids, nil, true)
+}
+
+// A little slack keeps a feed from slipping a whole cron run when the previous poll finished a few seconds late.
+const pollSlack = 30 * time.Second
+
+func isDue(feedRecord *storage.Feed, settings storage.EffectiveSettings, now time.Time) bool {
+	if feedRecord.LastPolled == nil {
+		return true
+	}
+	return now.Sub(*feedRecord.LastPolled)+pollSlack >= settings.PollInterval()
+}
+
+// CheckFeed polls a single feed right away. Used to apply the backlog policy of a new feed without waiting for the cron.
+func (rssreader *RSS_Reader) CheckFeed(id int) PollSummary {
+	return rssreader.CheckFeedIDs([]int{id})
+}
+
+// CheckFeedIDsInBackground polls the given feeds in the background, as the cron does, without waiting for it. Stop waits
+// for the poll, which is skipped when the reader is stopped before it starts.
+func (rssreader *RSS_Reader) CheckFeedIDsInBackground(ids []int) {
+	var ctx = rssreader.context()
+	rssreader.polling.Add(1)
+	go func() {
+		defer rssreader.polling.Done()
+		rssreader.poll(ctx, ids, nil, false)
+	}()
+}
+
+// CheckFeedIDs polls the given feeds right away and waits for their items to be sent. Unknown IDs are ignored.
+func (rssreader *RSS_Reader) CheckFeedIDs(ids []int) PollSummary {
+	return rssreader.poll(rssreader.context(), ids, nil, true)
+}
+
+// Fetches every given feed then sends the new items of all of them in chronological order. Feeds in prefetched
+// are not fetched again. When wait is false the poll returns once its items are queued on the sender.
+// The poll is skipped when ctx is canceled before it starts, and its sends are given up when canceled after.
+func (rssreader *RSS_Reader) poll(ctx context.Context, ids []int, prefetched map[int]fetchedFeed, wait bool) PollSummary {
+	summary, batch := rssreader.fetchAndQueue(ctx, ids, prefetched)
+	if batch != nil {
+		batch.summarize(&summary, wait)
+	}
+	return summary
+}
+
+// Fetches the feeds of a poll and queues the sends of their new items. Only one poll fetches at a time so that an
+// item is never sent by two polls.
+func (rssreader *RSS_Reader) fetchAndQueue(ctx context.Context, ids []int, prefetched map[int]fetchedFeed) (PollSummary, *sendBatch) {
+	rssreader.pollLock.Lock()
+	defer rssreader.pollLock.Unlock()
+
+	var summary = PollSummary{Errors: []string{}}
+	if err := context.Cause(ctx); err != nil {
+		rssreader.logger.Info("Skipping poll", "error", err)
+		summary.Errors = append(summary.Errors, err.Error())
+		return summary, nil
+	}
+	// Without the stored seen items every item would be sent again on every poll.
+	var loadError storage.LoadError
+	if errors.As(rssreader.Storage.Error(), &loadError) {
+		rssreader.logger.Error("Skipping poll", "error", loadError)
+		summary.Errors = append(summary.Errors, loadError.Error())
+		return summary, nil
+	}
+
+	// Read after taking the lock so that what a previous poll recorded is seen.
+	var feedRecords = map[int]*storage.Feed{}
+	for _, id := range ids {
+		if feedRecord := rssreader.Storage.GetFeedByID(id); feedRecord != nil {
+			feedRecords[id] = feedRecord
+		}
+	}
+
+	var settings = rssreader.Storage.GetSettings()
+	var groups = rssreader.Storage.GetGroups()
+	var now = time.Now()
+
+	ids = []int{}
+	for id := range feedRecords {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var polls = []*feedPoll{}
+	// Feeds fetched, whether or not they could be.
+	var polled = []int{}
+	var toSend = []pendingItem{}
+	for _, id := range ids {
+		var feedRecord = feedRecords[id]
+		// Webhook feeds have nothing to fetch. Their items arrive through ReceiveWebhook.
+		if feedRecord.Webhook != nil {
+			continue
+		}
+		if feedRecord.Paused || feedRecord.IsSnoozed(now) {
+			summary.Skipped++
+			continue
+		}
+		summary.Feeds++
+		rssreader.events.Publish(events.About(events.PollStart, id, feedRecord.Url))
+		polled = append(polled, id)
+		if err := rssreader.Storage.SaveFeedPolled(id, now); err != nil {
+			rssreader.logger.Error("Failed to record poll", logging.Feed(id), "error", err)
+		}
+		// A pending backlog or unseen items need the whole document even when it has not changed.
+		var conditional = feedRecord.Backlog == nil && len(feedRecord.Unseen) == 0
+		var err error
+		fetched, found := prefetched[id]
+		if !found {
+			fetched, err = fetchDocument(feedRecord, conditional)
+		}
+		rssreader.recordHealth(feedRecord, err, now)
+		var stats = storage.PollStats{NotModified: fetched.notModified, Failed: err != nil, Bytes: fetched.bytes, Latency: fetched.latency}
+		if err != nil || fetched.notModified {
+			if statsError := rssreader.Storage.RecordStats(id, now, stats); statsError != nil {
+				rssreader.logger.Error("Failed to record statistics", logging.Feed(id), "error", statsError)
+			}
+		}
+		if err != nil {
+			rssreader.logger.Warn("Failed to parse", logging.Feed(id), "url", feedRecord.Url, "error", err)
+			summary.Errors = append(summary.Errors, fmt.Sprintf("%s: %s", feedRecord.Name(), err))
+			continue
+		}
+		if fetched.notModified {
+			rssreader.logger.Debug("Feed not modified", logging.Feed(id))
+			summary.NotModified++
+			continue
+		}
+		if fetched.etag != feedRecord.ETag || fetched.lastModified != feedRecord.LastModified {
+			if err := rssreader.Storage.SaveFeedValidators(id, fetched.etag, fetched.lastModified); err != nil {
+				rssreader.logger.Error("Failed to record validators", logging.Feed(id), "error", err)
+			}
+		}
+		var result = rssreader.findNewItems(id, feedRecord, fetched.feed, settings, storage.ResolveSettings(feedRecord, groups[feedRecord.Group], settings), now)
+		result.stats = stats
+		rssreader.logger.Debug("Polled feed", logging.Feed(id), "found", len(result.feed.Items), "new", result.newCount, "bytes", fetched.bytes, "latency", fetched.latency)
+		summary.Found += len(result.feed.Items)
+		summary.New += result.newCount
+		polls = append(polls, result)
+		toSend = append(toSend, result.toSend...)
+	}
+
+	return summary, rssreader.queueSends(ctx, polls, toSend, polled, &summary, now)
+}
+
+// Records the outcome of fetching a feed, publishing when its health changes.
+func (rssreader *RSS_Reader) recordHealth(feedRecord *storage.Feed, fetchError error, now time.Time) {
+	var id = feedRecord.GetID()
+	if err := rssreader.Storage.SaveFeedHealth(id, fetchError, now); err != nil {
+		rssreader.logger.Error("Failed to record health", logging.Feed(id), "error", err)
+		return
+	}
+	if updated := rssreader.Storage.GetFeedByID(id); updated != nil && updated.Health(now) != feedRecord.Health(now) {
+		rssreader.events.Publish(events.About(events.Health, id, updated.Health(now)))
+	}
+}
+
+// The sends of a poll, made by the sender once the poll lock is released.
+type sendBatch struct {
+	ctx   context.Context
+	polls []*feedPoll
+	// Feeds fetched by the poll, whether or not they could be.
+	polled []int
+	// Items sent to Gotify, oldest first across all feeds.
+	items []pendingItem
+	// Messages about the feeds of the poll, such as a feed being paused, sent after the items.
+	notices []plugin.Message
+	now     time.Time
+	// Items delivered, forwarded and failed to send, set before done is closed.
+	delivered int
+	forwarded int
+	failed    int
+	done      chan struct{}
+}
+
+// Adds the outcome of the sends to the summary, waiting for them when asked to. Items not sent yet are counted as queued.
+func (batch *sendBatch) summarize(summary *PollSummary, wait bool) {
+	if wait {
+		<-batch.done
+	}
+	select {
+	case <-batch.done:
+		summary.Delivered += batch.delivered
+		summary.Forwarded += batch.forwarded
+		summary.Failed += batch.failed
+	default:
+		summary.Queued += len(batch.items)
+	}
+}
+
+// Saves what the feeds of a poll have seen, so that the next poll does not find the same items, then queues the sends
+// of their new items on the sender. The outcome of the poll is recorded right away when there is nothing to send.
+// Must hold the poll lock.
+func (rssreader *RSS_Reader) queueSends(ctx context.Context, polls []*feedPoll, toSend []pendingItem, polled []int, summary *PollSummary, now time.Time) *sendBatch {
+	var batch = &sendBatch{ctx: ctx, polled: polled, now: now, done: make(chan struct{})}
+	var pollsByID = map[int]*feedPoll{}
+	for _, result := range polls {
+		err := rssreader.Storage.SaveITemUrlsAndLatestDate(result.id, result.feedRecord.Url, result.urls, result.latest)
+		if errors.Is(err, storage.ErrFeedMoved) || errors.Is(err, storage.ErrFeedNotFound) {
+			// What was fetched is no longer what the feed holds, so none of it is sent or recorded.
+			rssreader.logger.Info("Dropped poll of a feed moved or removed while fetched", logging.Feed(result.id), "url", result.feedRecord.Url)
+			continue
+		}
+		err = errors.Join(err, rssreader.Storage.SaveFeedMeta(result.id, MetaFromFeed(result.feed)))
+		if err != nil {
+			rssreader.logger.Error("Failed to record seen items", logging.Feed(result.id), "error", err)
+		}
+		pollsByID[result.id] = result
+		batch.polls = append(batch.polls, result)
+
+		for _, delivery := range result.deliveries {
+			switch delivery.Status {
+			case storage.DeliveryFiltered:
+				summary.Filtered++
+			case storage.DeliveryDeferred:
+				summary.Deferred++
+			}
+		}
+		if len(result.pauseReason) != 0 {
+			err = rssreader.Storage.PauseFeed(result.id, result.pauseReason)
+			if err != nil {
+				rssreader.logger.Error("Failed to pause", logging.Feed(result.id), "error", err)
+			}
+			batch.notices = append(batch.notices, plugin.Message{
+				Title:    "Paused " + feedTitle(result.feed, result.feedRecord),
+				Message:  "The feed was paused because " + result.pauseReason + ". These items were marked as seen and not sent. Resume the feed from the config page once it looks right.",
+				Priority: 5,
+			})
+		}
+		if result.overflow > 0 {
+			rssreader.logger.Info("Summarized items over the limit per poll", logging.Feed(result.id), "items", result.overflow, "limit", result.settings.MaxItemsPerPoll.Value)
+			batch.notices = append(batch.notices, plugin.Message{
+				Title:    fmt.Sprintf("%s: %d more new items", feedTitle(result.feed, result.feedRecord), result.overflow),
+				Message:  fmt.Sprintf("%d older new items were not sent individually as the feed is limited to %d items per poll. %s", result.overflow, result.settings.MaxItemsPerPoll.Value, result.feed.Link),
+				Priority: result.settings.Priority.Value,
+			})
+		}
+	}
+
+	sortPending(toSend)
+	var forwarding = map[int][]*gofeed.Item{}
+	for _, pending := range toSend {
+		var result = pollsByID[pending.feedID]
+		if result == nil {
+			continue
+		}
+		if result.feedRecord.SendsToGotify() {
+			batch.items = append(batch.items, pending)
+		} else {
+			result.deliveries = append(result.deliveries, newDelivery(pending.item, storage.DeliveryForwarded, now))
+		}
+		if len(result.feedRecord.Targets) != 0 {
+			forwarding[pending.feedID] = append(forwarding[pending.feedID], pending.item)
+		}
+	}
+	for id, items := range forwarding {
+		rssreader.forward(pollsByID[id].feedRecord, items)
+	}
+
+	if len(batch.items) == 0 && len(batch.notices) == 0 {
+		rssreader.send(batch)
+	} else {
+		rssreader.sender.push(batch, &rssreader.sending, rssreader.send)
+	}
+	return batch
+}
+
+// Sends the items then the notices of a poll, waiting out the rate limit, and records what happened to each feed.
+// Items left when the reader is stopped are recorded as failed.
+func (rssreader *RSS_Reader) send(batch *sendBatch) {
+	defer close(batch.done)
+	var pollsByID = map[int]*feedPoll{}
+	for _, result := range batch.polls {
+		pollsByID[result.id] = result
+	}
+
+	for _, pending := range batch.items {
+		var delivery = newDelivery(pending.item, storage.DeliverySent, batch.now)
+		messageID, err := rssreader.sendRSSMessage(batch.ctx, *pending.item, pending.settings)
+		recordSend(&delivery, messageID, err)
+		if err != nil {
+			rssreader.logger.Warn("Failed to send item", logging.Feed(pending.feedID), "link", delivery.Link, "error", err)
+		} else {
+			rssreader.logger.Debug("Sent item", logging.Feed(pending.feedID), "link", delivery.Link)
+			rssreader.events.Publish(events.About(events.Delivered, pending.feedID, delivery.Title))
+		}
+		pollsByID[pending.feedID].deliveries = append(pollsByID[pending.feedID].deliveries, delivery)
+	}
+	for _, notice := range batch.notices {
+		if err := rssreader.sendMessage(batch.ctx, notice); err != nil {
+			rssreader.logger.Warn("Failed to send notice", "title", notice.Title, "error", err)
+		}
+	}
+
+	for _, result := range batch.polls {
+		result.stats.NewItems = result.newCount
+		for _, delivery := range result.deliveries {
+			switch delivery.Status {
+			case storage.DeliverySent:
+				result.stats.Delivered++
+			case storage.DeliveryForwarded:
+				result.stats.Forwarded++
+			case storage.DeliveryFiltered:
+				result.stats.Filtered++
+			case storage.DeliveryDeferred:
+				result.stats.Deferred++
+			case storage.DeliveryFailed:
+				result.stats.SendFailures++
+			}
+		}
+		batch.delivered += result.stats.Delivered
+		batch.forwarded += result.stats.Forwarded
+		batch.failed += result.stats.SendFailures
+		// The feed may have been removed, or a backup restored over it, while its items were sent.
+		if current := rssreader.Storage.GetFeedByID(result.id); current == nil || current.Url != result.feedRecord.Url {
+			continue
+		}
+		err := errors.Join(
+			rssreader.Storage.RecordDeliveries(result.id, result.deliveries),
+			rssreader.Storage.RecordStats(result.id, batch.now, result.stats),
+		)
+		if err != nil && !errors.Is(err, storage.ErrFeedNotFound) {
+			rssreader.logger.Error("Failed to record deliveries", logging.Feed(result.id), "error", err)
+		}
+	}
+	for _, id := range batch.polled {
+		rssreader.events.Publish(events.About(events.PollFinish, id, ""))
+	}
+}
+
+// Works out which items of a fetched feed are to be sent.
+func (rssreader *RSS_Reader) findNewItems(id int, feedRecord *storage.Feed, feed *gofeed.Feed, settings storage.Settings, effective storage.EffectiveSettings, now time.Time) *feedPoll {
+	var result = &feedPoll{id: id, feedRecord: feedRecord, feed: feed, urls: []string{}, settings: effective}
+
+	var newItems []*gofeed.Item
+	if feedRecord.Backlog != nil {
+		newItems = BacklogItems(*feedRecord.Backlog, feed.Items)
+		rssreader.logger.Info("Applied backlog", logging.Feed(id), "mode", feedRecord.Backlog.Mode, "sending", len(newItems), "found", len(feed.Items))
+	}
+
+	var order = map[*gofeed.Item]int{}
+	for itemIndex := len(feed.Items) - 1; itemIndex >= 0; itemIndex-- {
+		var item = feed.Items[itemIndex]
+		result.urls = append(result.urls, feedRecord.SeenKey(item.GUID, item.Link))
+		order[item] = len(feed.Items) - 1 - itemIndex
+
+		var timeOfPost = ItemTime(item)
+		if timeOfPost != nil && (result.latest == nil || result.latest.Compare(*timeOfPost) < 0) {
+			result.latest = timeOfPost
+		}
+
+		if feedRecord.Backlog == nil && feedRecord.IsItemNew(item) {
+			newItems = append(newItems, item)
+		}
+	}
+
+	if feedRecord.Backlog != nil {
+		var sending = map[*gofeed.Item]bool{}
+		for _, item := range newItems {
+			sending[item] = true
+		}
+		for itemIndex := len(feed.Items) - 1; itemIndex >= 0; itemIndex-- {
+			if !sending[feed.Items[itemIndex]] {
+				result.deliveries = append(result.deliveries, newDelivery(feed.Items[itemIndex], storage.DeliveryFiltered, now))
+			}
+		}
+	}
+
+	result.newCount = len(newItems)
+	if feedRecord.Backlog == nil && breakerTripped(settings, feedRecord, len(newItems), len(feed.Items)) {
+		result.pauseReason = fmt.Sprintf("%d of %d items looked new at once", len(newItems), len(feed.Items))
+		for _, item := range newItems {
+			result.deliveries = append(result.deliveries, newDelivery(item, storage.DeliveryFiltered, now))
+		}
+		return result
+	}
+
+	for _, item := range newItems {
+		var pending = pendingItem{feedID: id, item: item, settings: effective, time: now, order: order[item]}
+		if timeOfPost := ItemTime(item); timeOfPost != nil {
+			pending.time = *timeOfPost
+		}
+		result.toSend = append(result.toSend, pending)
+	}
+	sortPending(result.toSend)
+
+	var maxItems = effective.MaxItemsPerPoll.Value
+	if maxItems > 0 && len(result.toSend) > maxItems {
+		result.overflow = len(result.toSend) - maxItems
+		for _, pending := range result.toSend[:result.overflow] {
+			result.deliveries = append(result.deliveries, newDelivery(pending.item, storage.DeliveryDeferred, now))
+		}
+		result.toSend = result.toSend[result.overflow:]
+	}
+	return result
+}
+
+func newDelivery(item *gofeed.Item, status string, seenAt time.Time) storage.Delivery {
+	var delivery = storage.Delivery{ItemID: item.GUID, Title: item.Title, Link: item.Link, SeenAt: seenAt, Status: status}
+	if len(delivery.ItemID) == 0 {
+		delivery.ItemID = item.Link
+	}
+	return delivery
+}
+
+// Fills in the outcome of sending the item of the delivery.
+func recordSend(delivery *storage.Delivery, messageID int, err error) {
+	if err != nil {
+		delivery.Status = storage.DeliveryFailed
+		delivery.Error = err.Error()
+		return
+	}
+	var deliveredAt = time.Now()
+	delivery.Status = storage.DeliverySent
+	delivery.DeliveredAt = &deliveredAt
+	delivery.MessageID = messageID
+}
+
+// Sorts items oldest first. Ties are broken by feed ID then by position within the feed document.
+func sortPending(items []pendingItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].time.Equal(items[j].time) {
+			return items[i].time.Before(items[j].time)
+		}
+		if items[i].feedID != items[j].feedID {
+			return items[i].feedID < items[j].feedID
+		}
+		return items[i].order < items[j].order
+	})
+}
+
+// Whether so many of a feed's items look new that the feed was likely re-dated or replaced.
+// Feeds without any history are never considered, as every item is expected to be new. Nor are webhook feeds,
+// whose items are all new as they are pushed.
+func breakerTripped(settings storage.Settings, feedRecord *storage.Feed, newItems int, totalItems int) bool {
+	if feedRecord.Webhook != nil || settings.BreakerPercent <= 0 || totalItems == 0 || totalItems < settings.BreakerMinItems {
+		return false
+	}
+	if feedRecord.LastDate == nil && len(feedRecord.ItemUrls) == 0 {
+		return false
+	}
+	return newItems*100 > settings.BreakerPercent*totalItems
+}
+
+func feedTitle(feed *gofeed.Feed, feedRecord *storage.Feed) string {
+	if len(feedRecord.DisplayName) != 0 {
+		return feedRecord.DisplayName
+	}
+	if len(feed.Title) != 0 {
+		return feed.Title
+	}
+	return feedRecord.Url
+}
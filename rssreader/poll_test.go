@@ -0,0 +1,517 @@
+package rssreader
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/events"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/gotify/plugin-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMessageHandler struct {
+	sent []plugin.Message
+}
+
+func (handler *fakeMessageHandler) SendMessage(message plugin.Message) error {
+	handler.sent = append(handler.sent, message)
+	return nil
+}
+
+// Serves RSS feeds where each item is a day of January 2024 given newest first.
+// Answers 304 Not Modified when the ETag of the days is sent back.
+type testFeeds map[string][]int
+
+func (feeds testFeeds) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	days, present := feeds[request.URL.Path]
+	if !present {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var etag = fmt.Sprintf("%q", fmt.Sprint(days))
+	if request.Header.Get("If-None-Match") == etag {
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writer.Header().Set("ETag", etag)
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0"?><rss version="2.0"><channel><title>` + request.URL.Path + `</title>`)
+	for _, day := range days {
+		fmt.Fprintf(&body, `<item><title>%s %d</title><link>https://example.com%s/%d</link><pubDate>%s</pubDate></item>`,
+			request.URL.Path, day, request.URL.Path, day, time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC).Format(time.RFC1123Z))
+	}
+	body.WriteString(`</channel></rss>`)
+	writer.Write([]byte(body.String()))
+}
+
+func newTestReader(t *testing.T, feeds testFeeds) (*RSS_Reader, *fakeMessageHandler, string) {
+	var server = httptest.NewServer(feeds)
+	t.Cleanup(server.Close)
+
+	var logger = slog.New(slog.DiscardHandler)
+	var messages = &fakeMessageHandler{}
+	var reader = &RSS_Reader{}
+	reader.SetLogger(logger)
+	reader.SetStorage(storage.NewMemoryStorage(logger))
+	reader.SetMessageHandler(messages)
+	return reader, messages, server.URL
+}
+
+// Polls every feed whether or not it is due.
+func pollAll(reader *RSS_Reader) {
+	reader.CheckAllNow()
+}
+
+func links(messages []plugin.Message) []string {
+	var links = []string{}
+	for _, message := range messages {
+		links = append(links, message.Message)
+	}
+	return links
+}
+
+func TestBacklogLatest(t *testing.T) {
+	var feeds = testFeeds{"/a": {5, 4, 3, 2, 1}}
+	reader, messages, url := newTestReader(t, feeds)
+
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 2})
+	reader.CheckFeed(feed.GetID())
+	assert.Equal(t, []string{"https://example.com/a/4", "https://example.com/a/5"}, links(messages.sent))
+
+	pollAll(reader)
+	assert.Len(t, messages.sent, 2)
+}
+
+func TestNewItemsAreSentInOrderAcrossFeeds(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}, "/b": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+	reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	reader.Storage.SaveNewFeed(url+"/b", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	pollAll(reader)
+	assert.Empty(t, messages.sent)
+
+	feeds["/a"] = []int{6, 4, 2, 1}
+	feeds["/b"] = []int{5, 3, 1}
+	pollAll(reader)
+	assert.Equal(t, []string{
+		"https://example.com/b/3",
+		"https://example.com/a/4",
+		"https://example.com/b/5",
+		"https://example.com/a/6",
+	}, links(messages.sent))
+}
+
+func TestSortPendingBreaksTies(t *testing.T) {
+	var day = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var items = []pendingItem{
+		{feedID: 2, time: day, order: 0},
+		{feedID: 1, time: day, order: 1},
+		{feedID: 1, time: day, order: 0},
+		{feedID: 3, time: day.Add(-time.Hour), order: 5},
+	}
+	sortPending(items)
+	var keys = []string{}
+	for _, item := range items {
+		keys = append(keys, fmt.Sprintf("%d/%d", item.feedID, item.order))
+	}
+	assert.Equal(t, []string{"3/5", "1/0", "1/1", "2/0"}, keys)
+}
+
+func TestItemsOverTheLimitAreSummarized(t *testing.T) {
+	var feeds = testFeeds{"/a": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+	reader.Storage.SaveSettings(storage.Settings{MaxItemsPerPoll: 2})
+	reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	pollAll(reader)
+
+	feeds["/a"] = []int{5, 4, 3, 2, 1}
+	pollAll(reader)
+	assert.Len(t, messages.sent, 3)
+	assert.Equal(t, []string{"https://example.com/a/4", "https://example.com/a/5"}, links(messages.sent[:2]))
+	assert.Contains(t, messages.sent[2].Title, "2 more new items")
+}
+
+func TestBreakerPausesFeed(t *testing.T) {
+	var feeds = testFeeds{"/a": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+	reader.Storage.SaveSettings(storage.Settings{BreakerPercent: 50, BreakerMinItems: 4})
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	pollAll(reader)
+
+	feeds["/a"] = []int{5, 4, 3, 2, 1}
+	pollAll(reader)
+	assert.Len(t, messages.sent, 1)
+	assert.Contains(t, messages.sent[0].Title, "Paused")
+	assert.True(t, reader.Storage.GetFeedByID(feed.GetID()).Paused)
+
+	pollAll(reader)
+	assert.Len(t, messages.sent, 1)
+}
+
+func TestBreakerTripped(t *testing.T) {
+	var settings = storage.Settings{BreakerPercent: 50, BreakerMinItems: 4}
+	var seen = &storage.Feed{ItemUrls: map[string]bool{"https://example.com/1": true}}
+
+	assert.True(t, breakerTripped(settings, seen, 3, 4))
+	assert.False(t, breakerTripped(settings, seen, 2, 4))
+	// Too few items to tell.
+	assert.False(t, breakerTripped(settings, seen, 3, 3))
+	// Every item of a feed without history is new.
+	assert.False(t, breakerTripped(settings, &storage.Feed{}, 4, 4))
+	assert.False(t, breakerTripped(settings, &storage.Feed{ItemUrls: seen.ItemUrls, Webhook: &storage.WebhookSource{}}, 4, 4))
+	assert.False(t, breakerTripped(storage.Settings{}, seen, 4, 4))
+}
+
+func TestThrottledPollDoesNotHoldUpOthers(t *testing.T) {
+	var feeds = testFeeds{"/a": {3, 2, 1}, "/b": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+	reader.Storage.SaveSettings(storage.Settings{RateLimitPerMinute: 1})
+	throttled, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	quiet, _ := reader.Storage.SaveNewFeed(url+"/b", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	hook, err := reader.AddWebhookFeed("Doorbell", storage.WebhookSource{Mapping: storage.DefaultWebhookMapping()}, storage.FeedSettings{})
+	assert.NoError(t, err)
+
+	// The first item is sent right away and the next waits a minute for the rate limit.
+	var summary = reader.CheckFeeds()
+	assert.Equal(t, 3, summary.Queued)
+
+	var done = make(chan PollSummary)
+	go func() {
+		hookSummary, _ := reader.ReceiveWebhook(hook.GetID(), hook.Webhook.Token, http.Header{}, []byte(`{"title": "Ring", "message": "Front door"}`))
+		assert.Equal(t, 1, hookSummary.Queued)
+		done <- reader.CheckFeed(quiet.GetID())
+	}()
+	select {
+	case summary = <-done:
+		assert.Equal(t, 1, summary.Feeds)
+	case <-time.After(5 * time.Second):
+		t.Fatal("held up by the rate limit of another poll")
+	}
+
+	// Stopping gives up the items still waiting, which can be resent later.
+	reader.Stop()
+	assert.Equal(t, []string{"https://example.com/a/1"}, links(messages.sent))
+	assert.Equal(t, map[string]string{
+		"https://example.com/a/1": storage.DeliverySent,
+		"https://example.com/a/2": storage.DeliveryFailed,
+		"https://example.com/a/3": storage.DeliveryFailed,
+	}, statuses(reader.Storage.GetDeliveries(throttled.GetID())))
+	var deliveries = reader.Storage.GetDeliveries(hook.GetID())
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, storage.DeliveryFailed, deliveries[0].Status)
+		assert.Equal(t, errStopped.Error(), deliveries[0].Error)
+	}
+}
+
+func TestStopSkipsBackgroundPollsWaitingToStart(t *testing.T) {
+	reader, messages, url := newTestReader(t, testFeeds{"/a": {2, 1}})
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+
+	// Another poll is running while the plugin is disabled.
+	reader.pollLock.Lock()
+	reader.CheckFeedIDsInBackground([]int{feed.GetID()})
+	var stopped = make(chan struct{})
+	go func() {
+		reader.Stop()
+		close(stopped)
+	}()
+	require.Eventually(t, func() bool {
+		reader.lifetimeLock.Lock()
+		defer reader.lifetimeLock.Unlock()
+		return reader.lifetime == nil
+	}, time.Second, time.Millisecond)
+	reader.pollLock.Unlock()
+	<-stopped
+
+	assert.Empty(t, messages.sent)
+	assert.Nil(t, reader.Storage.GetFeedByID(feed.GetID()).LastPolled)
+}
+
+func TestFeedReplacedWhileFetchedKeepsItsBacklog(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}, "/b": {2, 1}}
+	reader, messages, _ := newTestReader(t, feeds)
+	var replaced = make(chan *storage.Feed, 1)
+	var server *httptest.Server
+	var feedID int
+	// The feed is removed and another added while the poll fetches it.
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/a" {
+			reader.Storage.RemoveFeedByID(feedID)
+			replacement, _ := reader.Storage.SaveNewFeed(server.URL+"/b", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+			replaced <- replacement
+		}
+		feeds.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+	feed, _ := reader.Storage.SaveNewFeed(server.URL+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	feedID = feed.GetID()
+
+	// The poll records nothing on the new feed, which keeps its backlog.
+	reader.CheckFeed(feed.GetID())
+	var replacement = <-replaced
+	assert.NotEqual(t, feed.GetID(), replacement.GetID())
+	assert.NotNil(t, reader.Storage.GetFeedByID(replacement.GetID()).Backlog)
+
+	reader.CheckFeed(replacement.GetID())
+	assert.Equal(t, []string{"https://example.com/b/1", "https://example.com/b/2"}, links(messages.sent))
+}
+
+// Gotify storage handler whose stored data cannot be loaded.
+type brokenStorageHandler struct{}
+
+func (brokenStorageHandler) Save(data []byte) error { return nil }
+
+func (brokenStorageHandler) Load() ([]byte, error) { return nil, errors.New("database is locked") }
+
+func TestPollIsSkippedWhenStorageFailsToLoad(t *testing.T) {
+	reader, messages, url := newTestReader(t, testFeeds{"/a": {1}})
+	reader.SetStorage(storage.NewGotifyStorage(brokenStorageHandler{}, slog.New(slog.DiscardHandler)))
+
+	var summary = reader.CheckAllNow()
+	assert.Equal(t, 0, summary.Feeds)
+	if assert.Len(t, summary.Errors, 1) {
+		assert.Contains(t, summary.Errors[0], "database is locked")
+	}
+	assert.Empty(t, messages.sent)
+	_, err := reader.AddFeed(url+"/a", NewFeed{})
+	assert.ErrorAs(t, err, &storage.LoadError{})
+}
+
+func TestImportWaitsForPoll(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}}
+	reader, messages, _ := newTestReader(t, feeds)
+	var imported = make(chan error, 1)
+	var server *httptest.Server
+	var backup []byte
+	// The backup is restored while the poll fetches the feed.
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		go func() {
+			_, err := reader.Import(backup, true)
+			imported <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		feeds.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+
+	var source = storage.NewMemoryStorage(slog.New(slog.DiscardHandler))
+	source.SaveNewFeed(server.URL+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	backup, _ = source.Export()
+	feed, _ := reader.Storage.SaveNewFeed(server.URL+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+
+	reader.CheckFeed(feed.GetID())
+	assert.NoError(t, <-imported)
+	// The restored feed is left as it was in the backup rather than marked as seen by the poll.
+	var restored = reader.Storage.GetFeedByID(feed.GetID())
+	assert.Equal(t, storage.BacklogAll, restored.Backlog.Mode)
+	assert.Empty(t, restored.ItemUrls)
+	assert.Empty(t, messages.sent)
+}
+
+func TestGroupSettingsApplyToFeeds(t *testing.T) {
+	var feeds = testFeeds{"/a": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+
+	var priority = 7
+	assert.NoError(t, reader.Storage.SaveGroup(storage.Group{Name: "News", Settings: storage.FeedSettings{Priority: &priority}}))
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	assert.NoError(t, reader.Storage.SaveFeedGroupAndTags(feed.GetID(), "News", nil))
+	reader.CheckFeeds()
+	reader.sending.Wait()
+
+	if assert.Len(t, messages.sent, 1) {
+		assert.Equal(t, 7, messages.sent[0].Priority)
+	}
+	assert.NotNil(t, reader.Storage.GetFeedByID(feed.GetID()).LastPolled)
+}
+
+func TestFeedsArePolledWhenDue(t *testing.T) {
+	var now = time.Now()
+	var minutes = 15
+	var effective = storage.ResolveSettings(&storage.Feed{Settings: storage.FeedSettings{PollMinutes: &minutes}}, nil, storage.DefaultSettings())
+
+	assert.True(t, isDue(&storage.Feed{}, effective, now))
+	var polled = now.Add(-10 * time.Minute)
+	assert.False(t, isDue(&storage.Feed{LastPolled: &polled}, effective, now))
+	polled = now.Add(-15*time.Minute + 10*time.Second)
+	assert.True(t, isDue(&storage.Feed{LastPolled: &polled}, effective, now))
+}
+
+func TestResumedFeedSkipsItemsFromWhilePaused(t *testing.T) {
+	var feeds = testFeeds{"/a": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	pollAll(reader)
+
+	assert.NoError(t, reader.Storage.PauseFeed(feed.GetID(), "paused manually"))
+	feeds["/a"] = []int{3, 2, 1}
+	pollAll(reader)
+	assert.Empty(t, messages.sent)
+
+	assert.NoError(t, reader.Storage.ResumeFeed(feed.GetID()))
+	pollAll(reader)
+	assert.Empty(t, messages.sent)
+
+	feeds["/a"] = []int{4, 3, 2, 1}
+	pollAll(reader)
+	assert.Equal(t, []string{"https://example.com/a/4"}, links(messages.sent))
+}
+
+func TestSnoozedFeedIsNotPolled(t *testing.T) {
+	var feeds = testFeeds{"/a": {1}}
+	reader, messages, url := newTestReader(t, feeds)
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	assert.NoError(t, reader.Storage.SnoozeFeed(feed.GetID(), time.Now().Add(time.Hour)))
+
+	pollAll(reader)
+	assert.Empty(t, messages.sent)
+	assert.Nil(t, reader.Storage.GetFeedByID(feed.GetID()).LastPolled)
+
+	assert.NoError(t, reader.Storage.SnoozeFeed(feed.GetID(), time.Now().Add(-time.Second)))
+	pollAll(reader)
+	assert.Len(t, messages.sent, 1)
+}
+
+func statuses(deliveries []storage.Delivery) map[string]string {
+	var statuses = map[string]string{}
+	for _, delivery := range deliveries {
+		statuses[delivery.Link] = delivery.Status
+	}
+	return statuses
+}
+
+func TestDeliveriesAreRecorded(t *testing.T) {
+	var feeds = testFeeds{"/a": {3, 2, 1}}
+	reader, messages, url := newTestReader(t, feeds)
+	reader.Storage.SaveSettings(storage.Settings{MaxItemsPerPoll: 1})
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 2})
+	pollAll(reader)
+
+	assert.Equal(t, map[string]string{
+		"https://example.com/a/1": storage.DeliveryFiltered,
+		"https://example.com/a/2": storage.DeliveryDeferred,
+		"https://example.com/a/3": storage.DeliverySent,
+	}, statuses(reader.Storage.GetDeliveries(feed.GetID())))
+	assert.Len(t, messages.sent, 2)
+
+	assert.NoError(t, reader.Storage.MarkItemUnseen(feed.GetID(), "https://example.com/a/1"))
+	pollAll(reader)
+	assert.Equal(t, "https://example.com/a/1", messages.sent[2].Message)
+	pollAll(reader)
+	assert.Len(t, messages.sent, 3)
+
+	var deliveries = reader.Storage.GetDeliveries(feed.GetID())
+	assert.NoError(t, reader.Resend(feed.GetID(), deliveries[1]))
+	assert.Equal(t, "https://example.com/a/2", messages.sent[3].Message)
+	deliveries = reader.Storage.GetDeliveries(feed.GetID())
+	assert.Equal(t, storage.DeliverySent, deliveries[len(deliveries)-1].Status)
+	assert.NotNil(t, deliveries[len(deliveries)-1].DeliveredAt)
+}
+
+func TestCheckSummary(t *testing.T) {
+	var feeds = testFeeds{"/a": {3, 2, 1}}
+	reader, _, url := newTestReader(t, feeds)
+	reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 1})
+	missing, _ := reader.Storage.SaveNewFeed(url+"/missing", storage.FeedMeta{}, nil)
+	paused, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, nil)
+	reader.Storage.PauseFeed(paused.GetID(), "paused manually")
+
+	var summary = reader.CheckAllNow()
+	assert.Equal(t, 2, summary.Feeds)
+	assert.Equal(t, 3, summary.Found)
+	assert.Equal(t, 1, summary.New)
+	assert.Equal(t, 2, summary.Filtered)
+	assert.Equal(t, 1, summary.Delivered)
+	assert.Equal(t, 1, summary.Skipped)
+	assert.Len(t, summary.Errors, 1)
+	assert.Equal(t, storage.HealthFailing, reader.Storage.GetFeedByID(missing.GetID()).Health(time.Now()))
+	assert.Equal(t, storage.HealthPaused, reader.Storage.GetFeedByID(paused.GetID()).Health(time.Now()))
+}
+
+func TestUnchangedFeedIsNotModified(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}}
+	reader, messages, url := newTestReader(t, feeds)
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, nil)
+
+	pollAll(reader)
+	assert.NotEmpty(t, reader.Storage.GetFeedByID(feed.GetID()).ETag)
+	var summary = reader.CheckAllNow()
+	assert.Equal(t, 1, summary.NotModified)
+	assert.Equal(t, 0, summary.Found)
+
+	// Marking an item unseen fetches the whole feed again.
+	reader.Storage.MarkItemUnseen(feed.GetID(), "https://example.com/a/1")
+	summary = reader.CheckAllNow()
+	assert.Equal(t, 0, summary.NotModified)
+	assert.Equal(t, 1, summary.Delivered)
+	assert.Len(t, messages.sent, 3)
+}
+
+func TestPollStatsAreRecorded(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}}
+	reader, _, url := newTestReader(t, feeds)
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, nil)
+	missing, _ := reader.Storage.SaveNewFeed(url+"/missing", storage.FeedMeta{}, nil)
+
+	pollAll(reader)
+	pollAll(reader)
+
+	var stats = storage.StatsSince(reader.Storage.GetStats(feed.GetID()), time.Now())
+	assert.Equal(t, 2, stats.Polls)
+	assert.Equal(t, 1, stats.NotModified)
+	assert.Equal(t, 2, stats.NewItems)
+	assert.Equal(t, 2, stats.Delivered)
+	assert.NotZero(t, stats.Bytes)
+
+	assert.Equal(t, 2, storage.StatsSince(reader.Storage.GetStats(missing.GetID()), time.Now()).ParseErrors)
+	var total = storage.StatsSince(reader.Storage.GetTotalStats(), time.Now())
+	assert.Equal(t, 4, total.Polls)
+	var fetches = 0
+	for _, count := range total.Latency {
+		fetches += count
+	}
+	assert.Equal(t, 4, fetches)
+}
+
+func TestPollEventsArePublished(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}}
+	reader, _, url := newTestReader(t, feeds)
+	var broker = events.NewBroker()
+	reader.SetEvents(broker)
+	published, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, nil)
+	missing, _ := reader.Storage.SaveNewFeed(url+"/missing", storage.FeedMeta{}, nil)
+
+	pollAll(reader)
+	var kinds = []string{}
+	for len(published) != 0 {
+		var event = <-published
+		kinds = append(kinds, fmt.Sprintf("%s %d %s", event.Kind, event.FeedID, event.Detail))
+	}
+	var id, missingID = feed.GetID(), missing.GetID()
+	assert.Equal(t, []string{
+		fmt.Sprintf("poll-start %d %s/a", id, url),
+		fmt.Sprintf("health %d ok", id),
+		fmt.Sprintf("poll-start %d %s/missing", missingID, url),
+		fmt.Sprintf("health %d failing", missingID),
+		fmt.Sprintf("delivered %d /a 1", id),
+		fmt.Sprintf("delivered %d /a 2", id),
+		fmt.Sprintf("poll-finish %d ", id),
+		fmt.Sprintf("poll-finish %d ", missingID),
+	}, kinds)
+
+	// Health is only published when it changes.
+	pollAll(reader)
+	for len(published) != 0 {
+		assert.NotEqual(t, events.Health, (<-published).Kind)
+	}
+}
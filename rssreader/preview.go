@@ -0,0 +1,98 @@
+package rssreader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/mmcdole/gofeed"
+)
+
+// Number of the latest items shown in a preview.
+const previewItems = 10
+
+// What subscribing to a feed would do, worked out before it is saved.
+type Preview struct {
+	Feed *gofeed.Feed
+	// The latest items, newest first.
+	Items []PreviewItem
+	// Number of items sent on the first poll.
+	Sent int
+	// Number of items over the items per poll limit that would be summarized in a single message.
+	Summarized int
+	Warnings   []string
+}
+
+type PreviewItem struct {
+	Title string
+	Link  string
+	Date  *time.Time
+	// Whether the item would be sent on the first poll.
+	Delivered bool
+}
+
+// PreviewFeed works out which items of a feed would be sent on the first poll under the backlog policy and items per poll limit.
+func PreviewFeed(feed *gofeed.Feed, policy storage.BacklogPolicy, maxItems int) Preview {
+	var preview = Preview{Feed: feed, Warnings: ParseWarnings(feed)}
+
+	var toSend = BacklogItems(policy, feed.Items)
+	if maxItems > 0 && len(toSend) > maxItems {
+		preview.Summarized = len(toSend) - maxItems
+		toSend = toSend[preview.Summarized:]
+	}
+	preview.Sent = len(toSend)
+	var delivered = map[*gofeed.Item]bool{}
+	for _, item := range toSend {
+		delivered[item] = true
+	}
+
+	var oldestFirst = BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogAll}, feed.Items)
+	for index := len(oldestFirst) - 1; index >= 0 && len(preview.Items) < previewItems; index-- {
+		var item = oldestFirst[index]
+		preview.Items = append(preview.Items, PreviewItem{Title: item.Title, Link: item.Link, Date: ItemTime(item), Delivered: delivered[item]})
+	}
+	return preview
+}
+
+// ParseWarnings lists problems with a feed that would affect how its items are sent.
+func ParseWarnings(feed *gofeed.Feed) []string {
+	var warnings = []string{}
+	if len(feed.Title) == 0 {
+		warnings = append(warnings, "The feed has no title")
+	}
+	if len(feed.Items) == 0 {
+		warnings = append(warnings, "The feed has no items")
+	}
+
+	var undated, unlinked, future int
+	var links = map[string]bool{}
+	var duplicates = 0
+	var now = time.Now()
+	for _, item := range feed.Items {
+		var itemTime = ItemTime(item)
+		if itemTime == nil {
+			undated++
+		} else if itemTime.After(now) {
+			future++
+		}
+		if len(item.Link) == 0 {
+			unlinked++
+		} else if links[item.Link] {
+			duplicates++
+		}
+		links[item.Link] = true
+	}
+	if undated != 0 {
+		warnings = append(warnings, fmt.Sprintf("%d of %d items have no date. New items are found by their links instead", undated, len(feed.Items)))
+	}
+	if future != 0 {
+		warnings = append(warnings, fmt.Sprintf("%d items are dated in the future", future))
+	}
+	if unlinked != 0 {
+		warnings = append(warnings, fmt.Sprintf("%d items have no link", unlinked))
+	}
+	if duplicates != 0 {
+		warnings = append(warnings, fmt.Sprintf("%d items share a link with another item", duplicates))
+	}
+	return warnings
+}
@@ -0,0 +1,45 @@
+package rssreader
+
+import "sync"
+
+// Runs jobs one at a time in the order they were pushed. The goroutine running them only runs while there are jobs.
+type workQueue[T any] struct {
+	lock    sync.Mutex
+	jobs    []T
+	running bool
+}
+
+// Adds a job to the queue, starting a goroutine that runs the jobs with run when none is running.
+// running tracks that goroutine so that the queue can be waited on.
+func (queue *workQueue[T]) push(job T, running *sync.WaitGroup, run func(T)) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.jobs = append(queue.jobs, job)
+	if queue.running {
+		return
+	}
+	queue.running = true
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		for {
+			queue.lock.Lock()
+			if len(queue.jobs) == 0 {
+				queue.running = false
+				queue.lock.Unlock()
+				return
+			}
+			var next = queue.jobs[0]
+			queue.jobs = queue.jobs[1:]
+			queue.lock.Unlock()
+			run(next)
+		}
+	}()
+}
+
+// Drops the jobs that have not started. The goroutine running them stops after its current job.
+func (queue *workQueue[T]) clear() {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	queue.jobs = nil
+}
@@ -0,0 +1,45 @@
+package rssreader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limits how many messages are sent within a sliding minute across all feeds.
+type rateLimiter struct {
+	lock sync.Mutex
+	sent []time.Time
+}
+
+// Blocks until another message may be sent under the given per minute limit. A limit of 0 or less never blocks.
+// Returns the cause of the context when it is canceled first.
+func (limiter *rateLimiter) wait(ctx context.Context, limit int) error {
+	if err := context.Cause(ctx); err != nil || limit <= 0 {
+		return err
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	for {
+		var now = time.Now()
+		var recent = limiter.sent[:0]
+		for _, sentAt := range limiter.sent {
+			if now.Sub(sentAt) < time.Minute {
+				recent = append(recent, sentAt)
+			}
+		}
+		limiter.sent = recent
+
+		if len(limiter.sent) < limit {
+			limiter.sent = append(limiter.sent, now)
+			return nil
+		}
+		var timer = time.NewTimer(time.Minute - now.Sub(limiter.sent[0]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return context.Cause(ctx)
+		case <-timer.C:
+		}
+	}
+}
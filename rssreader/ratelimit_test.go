@@ -0,0 +1,27 @@
+package rssreader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterWaits(t *testing.T) {
+	var limiter rateLimiter
+	var ctx = context.Background()
+	assert.NoError(t, limiter.wait(ctx, 2))
+	assert.NoError(t, limiter.wait(ctx, 2))
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	var start = time.Now()
+	assert.ErrorIs(t, limiter.wait(short, 2), context.DeadlineExceeded)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// A send is allowed again once the oldest one is a minute old.
+	limiter.sent[0] = time.Now().Add(-time.Minute)
+	assert.NoError(t, limiter.wait(ctx, 2))
+	assert.NoError(t, limiter.wait(ctx, 0))
+}
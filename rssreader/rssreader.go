@@ -1,9 +1,16 @@
 package rssreader
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/CEKlopfenstein/simple-feeds/events"
 	"github.com/CEKlopfenstein/simple-feeds/gotify_api"
 	"github.com/CEKlopfenstein/simple-feeds/storage"
 	"github.com/gorilla/websocket"
@@ -12,11 +19,29 @@ import (
 )
 
 type RSS_Reader struct {
-	listener  *websocket.Conn
-	gotifyApi gotify_api.GotifyApi
-	Storage   storage.Storage
-	userName  string
-	logger    *log.Logger
+	listener   *websocket.Conn
+	gotifyApi  gotify_api.GotifyApi
+	Storage    storage.Storage
+	userName   string
+	logger     *slog.Logger
+	msgHandler plugin.MessageHandler
+	limiter    rateLimiter
+	pollLock   sync.Mutex
+	events     *events.Broker
+	// Canceled by Stop to give up what is waiting in the background. Created on first use.
+	lifetime     context.Context
+	stop         context.CancelCauseFunc
+	lifetimeLock sync.Mutex
+	// Sends the items of polls in order once the poll lock is released, so that a poll waiting out the rate limit
+	// does not hold up the next one.
+	sender  workQueue[*sendBatch]
+	sending sync.WaitGroup
+	// Polls started in the background, such as those of imported feeds.
+	polling sync.WaitGroup
+	// Deliveries to targets in the background.
+	forwarding sync.WaitGroup
+	// The queue of deliveries of each target, keyed by feed and target ID.
+	targetQueues sync.Map
 }
 
 func (rssreader *RSS_Reader) SetGotifyApi(gotifyApi gotify_api.GotifyApi) {
@@ -31,56 +56,298 @@ func (rssreader *RSS_Reader) SetStorage(storage storage.Storage) {
 	rssreader.Storage = storage
 }
 
-func (rssreader *RSS_Reader) SetLogger(logger *log.Logger) {
+func (rssreader *RSS_Reader) SetLogger(logger *slog.Logger) {
 	rssreader.logger = logger
 }
+
+// SetEvents sets where polls, deliveries and health changes are published. Nothing is published when unset.
+func (rssreader *RSS_Reader) SetEvents(broker *events.Broker) {
+	rssreader.events = broker
+}
+
+func (rssreader *RSS_Reader) SetMessageHandler(msgHandler plugin.MessageHandler) {
+	rssreader.msgHandler = msgHandler
+}
+
+// Given as the reason an item was not sent when the reader is stopped before sending it.
+var errStopped = errors.New("the plugin was disabled")
+
+// The context of what runs in the background, canceled by Stop.
+func (rssreader *RSS_Reader) context() context.Context {
+	rssreader.lifetimeLock.Lock()
+	defer rssreader.lifetimeLock.Unlock()
+	if rssreader.lifetime == nil {
+		rssreader.lifetime, rssreader.stop = context.WithCancelCause(context.Background())
+	}
+	return rssreader.lifetime
+}
+
+// Stop gives up the polls, sends and deliveries to targets waiting in the background and waits for them to finish.
+// Items that were not sent are recorded as failed so that they can be resent. The reader can be used again afterwards.
+func (rssreader *RSS_Reader) Stop() {
+	rssreader.lifetimeLock.Lock()
+	if rssreader.stop != nil {
+		rssreader.stop(errStopped)
+	}
+	rssreader.lifetime, rssreader.stop = nil, nil
+	rssreader.lifetimeLock.Unlock()
+	// A poll in progress queues its items before they are given up, and those waiting to start are skipped.
+	rssreader.pollLock.Lock()
+	rssreader.pollLock.Unlock()
+	rssreader.polling.Wait()
+	rssreader.sending.Wait()
+	rssreader.forwarding.Wait()
+}
+
 func (rssreader *RSS_Reader) GetGotifyApi() gotify_api.GotifyApi {
 	return rssreader.gotifyApi
 }
 
+// EffectiveSettings resolves the settings of a feed from its own, its group's and the global settings.
+func (rssreader *RSS_Reader) EffectiveSettings(feed *storage.Feed) storage.EffectiveSettings {
+	var group *storage.Group
+	if len(feed.Group) != 0 {
+		group = rssreader.Storage.GetGroups()[feed.Group]
+	}
+	return storage.ResolveSettings(feed, group, rssreader.Storage.GetSettings())
+}
+
 func (rssreader *RSS_Reader) UpdateToken(token string) error {
-	rssreader.Storage.SaveClientToken(token)
 	err := rssreader.gotifyApi.UpdateToken(token)
 	if err != nil {
 		return err
 	}
-	return nil
+	return rssreader.Storage.SaveClientToken(token)
+}
+
+// NewFeed is what a feed is subscribed with besides its URL.
+type NewFeed struct {
+	Backlog     storage.BacklogPolicy
+	Settings    storage.FeedSettings
+	DisplayName string
+	// The group must exist. No group when empty.
+	Group string
+	Tags  []string
+}
+
+// AddFeed subscribes to the feed at feedUrl then polls it right away so that the backlog policy is applied.
+// Everything given is saved before the poll, which fetches nothing again as the document fetched to find the feed is
+// the one polled. The items of the backlog are sent in the background.
+// The feed is returned even when saving failed, as it is kept in memory.
+func (rssreader *RSS_Reader) AddFeed(feedUrl string, options NewFeed) (*storage.Feed, error) {
+	if len(options.Group) != 0 && rssreader.Storage.GetGroups()[options.Group] == nil {
+		return nil, storage.ErrGroupNotFound
+	}
+	fetched, err := fetchDocument(&storage.Feed{Url: feedUrl}, false)
+	if err != nil || fetched.feed == nil {
+		return nil, fmt.Errorf("no feed found at %s", feedUrl)
+	}
+	feed, err := rssreader.Storage.SaveNewFeed(feedUrl, MetaFromFeed(fetched.feed), &options.Backlog)
+	if feed == nil {
+		return nil, err
+	}
+	var id = feed.GetID()
+	err = errors.Join(err, rssreader.Storage.EditFeed(id, storage.FeedEdit{
+		DisplayName: &options.DisplayName,
+		Settings:    &options.Settings,
+		Group:       &options.Group,
+		Tags:        &options.Tags,
+	}))
+	rssreader.poll(rssreader.context(), []int{id}, map[int]fetchedFeed{id: fetched}, false)
+	return rssreader.Storage.GetFeedByID(id), err
+}
+
+// Import applies a backup to the storage once no poll is running, so that a poll does not record what it fetched
+// over the imported feeds.
+func (rssreader *RSS_Reader) Import(backup []byte, replace bool) (storage.ImportSummary, error) {
+	rssreader.pollLock.Lock()
+	defer rssreader.pollLock.Unlock()
+	return rssreader.Storage.Import(backup, replace)
+}
+
+// RefreshMeta fetches the feed to update its metadata without checking for new items.
+func (rssreader *RSS_Reader) RefreshMeta(id int) error {
+	var feedRecord = rssreader.Storage.GetFeedByID(id)
+	if feedRecord == nil {
+		return storage.ErrFeedNotFound
+	}
+	if feedRecord.Webhook != nil {
+		return errWebhookHasNoUrl
+	}
+	feed, err := FetchFeed(feedRecord.Url)
+	if err != nil {
+		return err
+	}
+	return rssreader.Storage.SaveFeedMeta(id, MetaFromFeed(feed))
+}
+
+// ChangeFeedUrl points a feed at a new URL once a feed is found there. The items seen so far are kept
+// when the new URL serves the same feed, otherwise what it holds now is marked as seen. Returns whether the history was kept.
+func (rssreader *RSS_Reader) ChangeFeedUrl(id int, feedUrl string) (bool, error) {
+	edit, err := rssreader.FeedUrlEdit(id, feedUrl)
+	if err != nil {
+		return false, err
+	}
+	return edit.KeepHistory, rssreader.Storage.EditFeed(id, edit)
+}
+
+// FeedUrlEdit fetches the feed at feedUrl and returns the edit moving the feed there, as ChangeFeedUrl would, without
+// saving it. The edit changes nothing when the feed is already at feedUrl.
+func (rssreader *RSS_Reader) FeedUrlEdit(id int, feedUrl string) (storage.FeedEdit, error) {
+	var feedRecord = rssreader.Storage.GetFeedByID(id)
+	if feedRecord == nil {
+		return storage.FeedEdit{}, storage.ErrFeedNotFound
+	}
+	if feedRecord.Webhook != nil {
+		return storage.FeedEdit{}, errWebhookHasNoUrl
+	}
+	if feedUrl == feedRecord.Url {
+		return storage.FeedEdit{KeepHistory: true}, nil
+	}
+	if err := ValidateURL(feedUrl); err != nil {
+		return storage.FeedEdit{}, err
+	}
+	for otherID, other := range rssreader.Storage.GetFeeds() {
+		if otherID != id && other.Url == feedUrl {
+			return storage.FeedEdit{}, fmt.Errorf("%s is already subscribed as %s", feedUrl, other.Name())
+		}
+	}
+	feed, err := FetchFeed(feedUrl)
+	if err != nil {
+		return storage.FeedEdit{}, fmt.Errorf("no feed found at %s: %w", feedUrl, err)
+	}
+	var meta = MetaFromFeed(feed)
+	return storage.FeedEdit{Url: &feedUrl, KeepHistory: SameFeed(feedRecord, feed), Meta: &meta}, nil
 }
 
-func (rssreader *RSS_Reader) CheckFeeds(msgHandler plugin.MessageHandler) {
-	var feeds = rssreader.Storage.GetFeeds()
-	for id, feedRecord := range *feeds {
-		fp := gofeed.NewParser()
-		feed, _ := fp.ParseURL(feedRecord.Url)
-		if feed == nil {
-			rssreader.Storage.Logger.Printf("Failed to parse: %s", feedRecord.Url)
-			continue
+// SameFeed guesses whether a fetched feed is the stored feed, such as after a site moved its feed.
+// It is when the feeds link to the same site or share an item already seen.
+func SameFeed(feedRecord *storage.Feed, feed *gofeed.Feed) bool {
+	if len(feed.Link) != 0 && feed.Link == feedRecord.Meta.SiteLink {
+		return true
+	}
+	for _, item := range feed.Items {
+		if feedRecord.ItemUrls[item.Link] {
+			return true
 		}
-		var latest *time.Time = nil
-		var urls = []string{}
-		for itemIndex := len(feed.Items) - 1; itemIndex >= 0; itemIndex-- {
-			var item = feed.Items[itemIndex]
-			urls = append(urls, item.Link)
-
-			var timeOfPost = item.UpdatedParsed
-			if timeOfPost == nil {
-				timeOfPost = item.PublishedParsed
-			}
+	}
+	return false
+}
 
-			if timeOfPost != nil && (latest == nil || latest.Compare(*timeOfPost) < 0) {
-				latest = timeOfPost
-			}
+func MetaFromFeed(feed *gofeed.Feed) storage.FeedMeta {
+	var meta = storage.FeedMeta{
+		Title:       feed.Title,
+		Description: feed.Description,
+		SiteLink:    feed.Link,
+		ItemCount:   len(feed.Items),
+		UpdatedAt:   time.Now(),
+	}
+	if feed.Image != nil {
+		meta.Icon = feed.Image.URL
+	}
+	return meta
+}
+
+// ValidateURL checks that a feed URL is an absolute http(s) URL. It does not check that a feed is served there.
+func ValidateURL(feedUrl string) error {
+	parsed, err := url.Parse(feedUrl)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return fmt.Errorf("%q is not an http or https URL", feedUrl)
+	}
+	return nil
+}
+
+// ItemTime returns the updated time of the item falling back to the published time. Nil if neither are present.
+func ItemTime(item *gofeed.Item) *time.Time {
+	if item.UpdatedParsed != nil {
+		return item.UpdatedParsed
+	}
+	return item.PublishedParsed
+}
+
+// BacklogItems returns the items that should be sent under the given policy, oldest first.
+// Items are assumed to be in document order (newest first) which is used when items lack a date.
+func BacklogItems(policy storage.BacklogPolicy, items []*gofeed.Item) []*gofeed.Item {
+	var ordered = make([]*gofeed.Item, len(items))
+	for index, item := range items {
+		ordered[len(items)-1-index] = item
+	}
+	var allDated = true
+	for _, item := range ordered {
+		allDated = allDated && ItemTime(item) != nil
+	}
+	if allDated {
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ItemTime(ordered[i]).Before(*ItemTime(ordered[j]))
+		})
+	}
 
-			if feedRecord.IsItemNew(item, &rssreader.Storage) {
-				rssreader.sendRSSMessage(msgHandler, *item)
+	switch policy.Mode {
+	case storage.BacklogAll:
+		return ordered
+	case storage.BacklogLatest:
+		if policy.Count <= 0 {
+			return nil
+		}
+		if policy.Count >= len(ordered) {
+			return ordered
+		}
+		return ordered[len(ordered)-policy.Count:]
+	case storage.BacklogSince:
+		var toSend []*gofeed.Item
+		for _, item := range ordered {
+			var timeOfPost = ItemTime(item)
+			if policy.Since != nil && timeOfPost != nil && timeOfPost.After(*policy.Since) {
+				toSend = append(toSend, item)
 			}
 		}
+		return toSend
+	}
+	return nil
+}
 
-		rssreader.Storage.SaveITemUrlsAndLatestDate(id, urls, latest)
+// Sends an item as a message. Returns the ID of the message when known, which is only when sent with an application token.
+func (rssreader *RSS_Reader) sendRSSMessage(ctx context.Context, item gofeed.Item, settings storage.EffectiveSettings) (int, error) {
+	var message = plugin.Message{Title: item.Title, Message: item.Link, Priority: settings.Priority.Value}
+	// Items without a link, such as those pushed to a webhook, are sent with their description instead.
+	if len(message.Message) == 0 {
+		message.Message = item.Description
+	}
+	if len(settings.AppToken.Value) != 0 {
+		if err := rssreader.limiter.wait(ctx, rssreader.Storage.GetSettings().RateLimitPerMinute); err != nil {
+			return 0, err
+		}
+		sent, err := rssreader.gotifyApi.SendMessage(settings.AppToken.Value, gotify_api.GotifyMessage{Title: message.Title, Message: message.Message, Priority: message.Priority})
+		return sent.Id, err
 	}
+	return 0, rssreader.sendMessage(ctx, message)
+}
 
+// Resend sends an item from the delivery log of a feed again, to Gotify and the targets of the feed as it would be
+// sent when new, and records the outcome in the log.
+func (rssreader *RSS_Reader) Resend(id int, delivery storage.Delivery) error {
+	var feedRecord = rssreader.Storage.GetFeedByID(id)
+	if feedRecord == nil {
+		return storage.ErrFeedNotFound
+	}
+	var item = gofeed.Item{Title: delivery.Title, Link: delivery.Link, GUID: delivery.ItemID}
+	rssreader.forward(feedRecord, []*gofeed.Item{&item})
+	if !feedRecord.SendsToGotify() {
+		delivery.Status = storage.DeliveryForwarded
+		delivery.Error = ""
+		return rssreader.Storage.RecordDeliveries(id, []storage.Delivery{delivery})
+	}
+	messageID, err := rssreader.sendRSSMessage(rssreader.context(), item, rssreader.EffectiveSettings(feedRecord))
+	recordSend(&delivery, messageID, err)
+	return errors.Join(err, rssreader.Storage.RecordDeliveries(id, []storage.Delivery{delivery}))
 }
 
-func (rssreader *RSS_Reader) sendRSSMessage(msgHandler plugin.MessageHandler, item gofeed.Item) error {
-	return msgHandler.SendMessage(plugin.Message{Title: item.Title + " " + item.Title, Message: item.Link})
+func (rssreader *RSS_Reader) sendMessage(ctx context.Context, message plugin.Message) error {
+	if err := rssreader.limiter.wait(ctx, rssreader.Storage.GetSettings().RateLimitPerMinute); err != nil {
+		return err
+	}
+	return rssreader.msgHandler.SendMessage(message)
 }
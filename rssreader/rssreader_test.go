@@ -0,0 +1,156 @@
+package rssreader
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSameFeed(t *testing.T) {
+	var feedRecord = &storage.Feed{Meta: storage.FeedMeta{SiteLink: "https://example.com"}, ItemUrls: map[string]bool{"https://example.com/1": true}}
+
+	assert.True(t, SameFeed(feedRecord, &gofeed.Feed{Link: "https://example.com"}))
+	assert.True(t, SameFeed(feedRecord, &gofeed.Feed{Items: []*gofeed.Item{{Link: "https://example.com/1"}}}))
+	assert.False(t, SameFeed(feedRecord, &gofeed.Feed{Link: "https://other.example.com", Items: []*gofeed.Item{{Link: "https://other.example.com/1"}}}))
+}
+
+func TestChangeFeedUrlToAnotherFeed(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}, "/b": {3, 2, 1}}
+	reader, messages, url := newTestReader(t, feeds)
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogNone})
+	pollAll(reader)
+
+	_, err := reader.ChangeFeedUrl(feed.GetID(), url+"/missing")
+	assert.Error(t, err)
+	kept, err := reader.ChangeFeedUrl(feed.GetID(), url+"/b")
+	assert.NoError(t, err)
+	assert.False(t, kept)
+	assert.Equal(t, url+"/b", reader.Storage.GetFeedByID(feed.GetID()).Url)
+
+	pollAll(reader)
+	assert.Empty(t, messages.sent)
+	feeds["/b"] = []int{4, 3, 2, 1}
+	pollAll(reader)
+	assert.Equal(t, []string{"https://example.com/b/4"}, links(messages.sent))
+}
+
+func TestPreviewFeed(t *testing.T) {
+	var items = []*gofeed.Item{}
+	for day := 12; day >= 1; day-- {
+		var date = time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+		items = append(items, &gofeed.Item{Title: fmt.Sprint(day), Link: fmt.Sprintf("https://example.com/%d", day), PublishedParsed: &date})
+	}
+	items = append(items, &gofeed.Item{Title: "undated"})
+	var feed = &gofeed.Feed{Title: "Example", Items: items}
+
+	var preview = PreviewFeed(feed, storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 3}, 2)
+	assert.Equal(t, 2, preview.Sent)
+	assert.Equal(t, 1, preview.Summarized)
+	if assert.Len(t, preview.Items, 10) {
+		assert.Equal(t, "12", preview.Items[0].Title)
+		assert.True(t, preview.Items[0].Delivered)
+		assert.True(t, preview.Items[1].Delivered)
+		assert.False(t, preview.Items[2].Delivered)
+	}
+	assert.Len(t, preview.Warnings, 2)
+}
+
+func TestPlanUrlReplace(t *testing.T) {
+	var reader = &RSS_Reader{}
+	reader.SetStorage(storage.NewMemoryStorage(slog.New(slog.DiscardHandler)))
+	first, _ := reader.Storage.SaveNewFeed("http://old.example.com/a.xml", storage.FeedMeta{}, nil)
+	second, _ := reader.Storage.SaveNewFeed("http://old.example.com/b.xml", storage.FeedMeta{}, nil)
+	other, _ := reader.Storage.SaveNewFeed("https://other.example.com/feed", storage.FeedMeta{}, nil)
+	var ids = []int{first.GetID(), second.GetID(), other.GetID()}
+
+	changes, err := reader.PlanUrlReplace(ids, "http://old.", "https://new.")
+	assert.NoError(t, err)
+	assert.Equal(t, []UrlChange{
+		{ID: first.GetID(), Name: "http://old.example.com/a.xml", From: "http://old.example.com/a.xml", To: "https://new.example.com/a.xml"},
+		{ID: second.GetID(), Name: "http://old.example.com/b.xml", From: "http://old.example.com/b.xml", To: "https://new.example.com/b.xml"},
+	}, changes)
+	// Planning changes nothing.
+	assert.Equal(t, "http://old.example.com/a.xml", reader.Storage.GetFeedByID(first.GetID()).Url)
+
+	_, err = reader.PlanUrlReplace(ids, "http://old.example.com/a.xml", "https://other.example.com/feed")
+	assert.Error(t, err)
+	_, err = reader.PlanUrlReplace(ids, "http://", "ftp://")
+	assert.Error(t, err)
+
+	_, err = reader.ReplaceFeedUrls(ids, "http://old.", "https://new.")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://new.example.com/b.xml", reader.Storage.GetFeedByID(second.GetID()).Url)
+}
+
+func TestBacklogItems(t *testing.T) {
+	var items = []*gofeed.Item{}
+	for day := 4; day >= 1; day-- {
+		var date = time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+		items = append(items, &gofeed.Item{Title: fmt.Sprint(day), PublishedParsed: &date})
+	}
+	var titles = func(items []*gofeed.Item) []string {
+		var titles = []string{}
+		for _, item := range items {
+			titles = append(titles, item.Title)
+		}
+		return titles
+	}
+	var since = time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{"1", "2", "3", "4"}, titles(BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogAll}, items)))
+	assert.Empty(t, BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogNone}, items))
+	assert.Equal(t, []string{"3", "4"}, titles(BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 2}, items)))
+	assert.Equal(t, []string{"1", "2", "3", "4"}, titles(BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 10}, items)))
+	assert.Empty(t, BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogLatest}, items))
+	assert.Equal(t, []string{"3", "4"}, titles(BacklogItems(storage.BacklogPolicy{Mode: storage.BacklogSince, Since: &since}, items)))
+}
+
+func TestAddFeedSavesEverythingBeforeTheFirstPoll(t *testing.T) {
+	var feeds = testFeeds{"/a": {2, 1}}
+	reader, messages, url := newTestReader(t, feeds)
+	var priority = 7
+	assert.NoError(t, reader.Storage.SaveGroup(storage.Group{Name: "News", Settings: storage.FeedSettings{Priority: &priority}}))
+
+	_, err := reader.AddFeed(url+"/a", NewFeed{Group: "Missing"})
+	assert.ErrorIs(t, err, storage.ErrGroupNotFound)
+	assert.Empty(t, reader.Storage.GetFeeds())
+
+	feed, err := reader.AddFeed(url+"/a", NewFeed{Backlog: storage.BacklogPolicy{Mode: storage.BacklogAll}, DisplayName: "Daily", Group: "News", Tags: []string{"daily"}})
+	assert.NoError(t, err)
+	reader.sending.Wait()
+	assert.Equal(t, "Daily", feed.DisplayName)
+	assert.Equal(t, []string{"daily"}, feed.Tags)
+	// The backlog was sent with the priority of the group.
+	if assert.Len(t, messages.sent, 2) {
+		assert.Equal(t, 7, messages.sent[0].Priority)
+	}
+}
+
+func TestAddFeedFetchesOnce(t *testing.T) {
+	var feeds = testFeeds{"/a": {3, 2, 1}}
+	var requests atomic.Int32
+	var server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		feeds.ServeHTTP(writer, request)
+	}))
+	defer server.Close()
+	reader, messages, _ := newTestReader(t, feeds)
+
+	feed, err := reader.AddFeed(server.URL+"/a", NewFeed{Backlog: storage.BacklogPolicy{Mode: storage.BacklogLatest, Count: 1}})
+	assert.NoError(t, err)
+	reader.sending.Wait()
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Equal(t, "/a", feed.Meta.Title)
+	assert.Nil(t, feed.Backlog)
+	if assert.Len(t, messages.sent, 1) {
+		assert.Equal(t, "/a 3", messages.sent[0].Title)
+	}
+}
@@ -0,0 +1,252 @@
+package rssreader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/events"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/mmcdole/gofeed"
+)
+
+var targetClient = &http.Client{Timeout: 15 * time.Second}
+
+// Waits before each retry of a delivery to a target. There are as many retries as waits.
+var targetBackoff = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute}
+
+// Methods a target can be sent with.
+var TargetMethods = []string{http.MethodPost, http.MethodPut, http.MethodPatch}
+
+// TargetItem is what the body template of a target is rendered over. Targets without a template are sent it as JSON.
+type TargetItem struct {
+	Feed        string     `json:"feed"`
+	FeedID      int        `json:"feedId"`
+	Title       string     `json:"title"`
+	Link        string     `json:"link,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	ID          string     `json:"id,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+}
+
+// Functions of body templates. json encodes a value such as a title as JSON, quotes included.
+var targetFuncs = template.FuncMap{
+	"json": func(value any) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// NewTarget checks a target and gives it an ID. The method defaults to POST and the body template must render JSON.
+func NewTarget(name string, targetUrl string, method string, headers map[string]string, body string) (storage.Target, error) {
+	if err := ValidateURL(targetUrl); err != nil {
+		return storage.Target{}, err
+	}
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if len(method) == 0 {
+		method = http.MethodPost
+	}
+	if !slices.Contains(TargetMethods, method) {
+		return storage.Target{}, fmt.Errorf("targets are sent with %s, not %s", strings.Join(TargetMethods, ", "), method)
+	}
+	for header, value := range headers {
+		if len(header) == 0 || strings.ContainsAny(header, " \t\r\n:") || strings.ContainsAny(value, "\r\n") {
+			return storage.Target{}, fmt.Errorf("invalid header %q", header)
+		}
+	}
+	var target = storage.Target{ID: NewWebhookToken()[:8], Name: strings.TrimSpace(name), URL: targetUrl, Method: method, Headers: headers, Body: strings.TrimSpace(body)}
+	// Rendering an example shows mistakes in the template now rather than on the first delivery.
+	var published = time.Now()
+	var example = TargetItem{Feed: "Example", Title: "Example item", Link: "https://example.com/item", Description: "Example description", Author: "Example author", ID: "example", Published: &published}
+	if _, err := TargetBody(target, example); err != nil {
+		return storage.Target{}, err
+	}
+	return target, nil
+}
+
+// TargetBody renders the body sent to the target for an item.
+func TargetBody(target storage.Target, item TargetItem) ([]byte, error) {
+	if len(target.Body) == 0 {
+		return json.Marshal(item)
+	}
+	tmpl, err := template.New("body").Funcs(targetFuncs).Parse(target.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	var body = new(bytes.Buffer)
+	if err := tmpl.Execute(body, item); err != nil {
+		return nil, fmt.Errorf("invalid body template: %w", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, errors.New("the body template does not render JSON. Use json to quote values, such as {{json .Title}}")
+	}
+	return body.Bytes(), nil
+}
+
+func targetItemOf(feedRecord *storage.Feed, item *gofeed.Item) TargetItem {
+	var targetItem = TargetItem{
+		Feed:        feedRecord.Name(),
+		FeedID:      feedRecord.GetID(),
+		Title:       item.Title,
+		Link:        item.Link,
+		Description: item.Description,
+		ID:          item.GUID,
+		Published:   ItemTime(item),
+	}
+	if len(item.Authors) != 0 && item.Authors[0] != nil {
+		targetItem.Author = item.Authors[0].Name
+	}
+	return targetItem
+}
+
+var errTargetRemoved = errors.New("the target was removed")
+
+// The deliveries to a target, in order. removed is canceled when the target is removed, giving up its deliveries.
+type targetQueue struct {
+	workQueue[targetDelivery]
+	removed context.Context
+	remove  context.CancelCauseFunc
+}
+
+func targetQueueKey(id int, targetID string) string {
+	return fmt.Sprintf("%d/%s", id, targetID)
+}
+
+// A delivery of an item to a target, given up when ctx is canceled.
+type targetDelivery struct {
+	ctx    context.Context
+	id     int
+	target storage.Target
+	item   TargetItem
+}
+
+// Delivers items to every target of the feed in the background. Each target has its own queue so that it gets the
+// items in order, one delivery at a time, and a target that is down holds up only itself while its deliveries are retried.
+func (rssreader *RSS_Reader) forward(feedRecord *storage.Feed, items []*gofeed.Item) {
+	var id = feedRecord.GetID()
+	var ctx = rssreader.context()
+	for _, target := range feedRecord.Targets {
+		var created = &targetQueue{}
+		created.removed, created.remove = context.WithCancelCause(context.Background())
+		loaded, _ := rssreader.targetQueues.LoadOrStore(targetQueueKey(id, target.ID), created)
+		var queue = loaded.(*targetQueue)
+		for _, item := range items {
+			queue.push(targetDelivery{ctx: ctx, id: id, target: target, item: targetItemOf(feedRecord, item)}, &rssreader.forwarding, func(delivery targetDelivery) {
+				deliveryCtx, cancel := context.WithCancelCause(delivery.ctx)
+				var stop = context.AfterFunc(queue.removed, func() { cancel(context.Cause(queue.removed)) })
+				rssreader.deliverToTarget(deliveryCtx, delivery.id, delivery.target, delivery.item)
+				stop()
+				cancel(nil)
+			})
+		}
+	}
+}
+
+// RemoveTarget removes a target from the feed and gives up the deliveries to it, including the one being retried.
+func (rssreader *RSS_Reader) RemoveTarget(id int, targetID string) (storage.Target, error) {
+	var feedRecord = rssreader.Storage.GetFeedByID(id)
+	if feedRecord == nil {
+		return storage.Target{}, storage.ErrFeedNotFound
+	}
+	target, found := feedRecord.Target(targetID)
+	if !found {
+		return storage.Target{}, storage.ErrTargetNotFound
+	}
+	var kept = []storage.Target{}
+	for _, other := range feedRecord.Targets {
+		if other.ID != targetID {
+			kept = append(kept, other)
+		}
+	}
+	if err := rssreader.Storage.SaveFeedTargets(id, kept, feedRecord.TargetsOnly); err != nil {
+		return storage.Target{}, err
+	}
+	if loaded, found := rssreader.targetQueues.LoadAndDelete(targetQueueKey(id, targetID)); found {
+		var queue = loaded.(*targetQueue)
+		queue.clear()
+		queue.remove(errTargetRemoved)
+	}
+	return target, nil
+}
+
+// Sends an item to a target, retrying after each wait of targetBackoff while it fails in a way that may pass,
+// then records and publishes the outcome. Stops retrying when ctx is canceled.
+func (rssreader *RSS_Reader) deliverToTarget(ctx context.Context, id int, target storage.Target, item TargetItem) storage.TargetResult {
+	var result = storage.TargetResult{Title: item.Title}
+	body, err := TargetBody(target, item)
+	for err == nil {
+		if err = context.Cause(ctx); err != nil {
+			break
+		}
+		result.Attempts++
+		result.StatusCode, err = sendToTarget(ctx, target, body)
+		if err == nil || !retryable(result.StatusCode) || result.Attempts > len(targetBackoff) {
+			break
+		}
+		rssreader.logger.Debug("Retrying target", logging.Feed(id), "target", target.Label(), "attempt", result.Attempts, "error", err)
+		var timer = time.NewTimer(targetBackoff[result.Attempts-1])
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = context.Cause(ctx)
+		case <-timer.C:
+			err = nil
+		}
+	}
+	result.At = time.Now()
+	if err != nil {
+		result.Error = err.Error()
+		rssreader.logger.Warn("Failed to deliver to target", logging.Feed(id), "target", target.Label(), "title", item.Title, "attempts", result.Attempts, "error", err)
+	} else {
+		rssreader.logger.Info("Delivered to target", logging.Feed(id), "target", target.Label(), "title", item.Title, "attempts", result.Attempts)
+	}
+	// The target or its feed may have been removed while retrying.
+	var recordError = rssreader.Storage.RecordTargetResult(id, target.ID, result)
+	if recordError != nil && !errors.Is(recordError, storage.ErrTargetNotFound) && !errors.Is(recordError, storage.ErrFeedNotFound) {
+		rssreader.logger.Error("Failed to record target result", logging.Feed(id), "target", target.Label(), "error", recordError)
+	}
+	rssreader.events.Publish(events.About(events.Forwarded, id, target.Label()))
+	return result
+}
+
+// Responses that may succeed when tried again. Zero is no response at all.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// Returns the status of the response, zero when there was none.
+func sendToTarget(ctx context.Context, target storage.Target, body []byte) (int, error) {
+	var method = target.Method
+	if len(method) == 0 {
+		method = http.MethodPost
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "simple-feeds")
+	for header, value := range target.Headers {
+		request.Header.Set(header, value)
+	}
+	response, err := targetClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("target answered %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
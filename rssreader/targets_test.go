@@ -0,0 +1,200 @@
+package rssreader
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Receives the requests of targets, failing the first failFirst of them with 503 Service Unavailable.
+type testTarget struct {
+	lock      sync.Mutex
+	failFirst int
+	requests  int
+	bodies    []string
+	headers   []http.Header
+}
+
+func (target *testTarget) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	target.lock.Lock()
+	defer target.lock.Unlock()
+	target.requests++
+	if target.requests <= target.failFirst {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(request.Body)
+	target.bodies = append(target.bodies, string(body))
+	target.headers = append(target.headers, request.Header)
+}
+
+func TestNewTarget(t *testing.T) {
+	target, err := NewTarget(" Chat ", "https://chat.example.com/hook", "put", map[string]string{"Authorization": "Bearer x"}, `{"text": {{json .Title}}}`)
+	require.NoError(t, err)
+	assert.Equal(t, "Chat", target.Name)
+	assert.Equal(t, http.MethodPut, target.Method)
+	assert.Len(t, target.ID, 8)
+
+	target, err = NewTarget("", "https://chat.example.com/hook", "", nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, target.Method)
+
+	for _, body := range []string{`{"text": {{.Title}}}`, `{"text": {{json .Missing}}}`, `{"text": {{json .Title}`} {
+		_, err = NewTarget("", "https://chat.example.com/hook", "", nil, body)
+		assert.Error(t, err, body)
+	}
+	_, err = NewTarget("", "ftp://chat.example.com/hook", "", nil, "")
+	assert.Error(t, err)
+	_, err = NewTarget("", "https://chat.example.com/hook", "GET", nil, "")
+	assert.Error(t, err)
+	_, err = NewTarget("", "https://chat.example.com/hook", "", map[string]string{"Bad Header": "x"}, "")
+	assert.Error(t, err)
+}
+
+func TestTargetBody(t *testing.T) {
+	var item = TargetItem{Feed: "News", FeedID: 2, Title: `Say "hi"`, Link: "https://example.com/1"}
+	body, err := TargetBody(storage.Target{Body: `{"text": {{json .Title}}, "url": {{json .Link}}}`}, item)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "Say \"hi\"", "url": "https://example.com/1"}`, string(body))
+
+	body, err = TargetBody(storage.Target{}, item)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"feed": "News", "feedId": 2, "title": "Say \"hi\"", "link": "https://example.com/1"}`, string(body))
+}
+
+func TestItemsAreForwardedToTargets(t *testing.T) {
+	defer func(backoff []time.Duration) { targetBackoff = backoff }(targetBackoff)
+	targetBackoff = []time.Duration{time.Millisecond, time.Millisecond}
+
+	var receiver = &testTarget{failFirst: 1}
+	var server = httptest.NewServer(receiver)
+	defer server.Close()
+	var feeds = testFeeds{"/a": {2, 1}}
+	reader, messages, url := newTestReader(t, feeds)
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	var id = feed.GetID()
+	target, err := NewTarget("Chat", server.URL, "", map[string]string{"Authorization": "Bearer x"}, `{"text": {{json .Title}}}`)
+	require.NoError(t, err)
+	require.NoError(t, reader.Storage.SaveFeedTargets(id, []storage.Target{target}, false))
+
+	reader.CheckFeed(id)
+	reader.forwarding.Wait()
+	assert.Len(t, messages.sent, 2)
+	require.Len(t, receiver.bodies, 2)
+	var first map[string]string
+	require.NoError(t, json.Unmarshal([]byte(receiver.bodies[0]), &first))
+	assert.Equal(t, "/a 1", first["text"])
+	assert.Equal(t, "Bearer x", receiver.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", receiver.headers[0].Get("Content-Type"))
+
+	stored, _ := reader.Storage.GetFeedByID(id).Target(target.ID)
+	require.NotNil(t, stored.Last)
+	assert.Equal(t, "/a 2", stored.Last.Title)
+	assert.Empty(t, stored.Last.Error)
+
+	// Targets only: nothing goes to Gotify and a target that keeps failing gives up after the retries.
+	require.NoError(t, reader.Storage.SaveFeedTargets(id, []storage.Target{target}, true))
+	receiver.failFirst = receiver.requests + 10
+	feeds["/a"] = []int{3, 2, 1}
+	reader.CheckFeed(id)
+	reader.forwarding.Wait()
+	assert.Len(t, messages.sent, 2)
+	stored, _ = reader.Storage.GetFeedByID(id).Target(target.ID)
+	assert.Equal(t, 3, stored.Last.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, stored.Last.StatusCode)
+	assert.NotEmpty(t, stored.Last.Error)
+	var deliveries = reader.Storage.GetDeliveries(id)
+	assert.Equal(t, storage.DeliveryForwarded, deliveries[len(deliveries)-1].Status)
+	// Items handed to targets are not counted as delivered, as the targets may not have taken them.
+	var stats = storage.StatsSince(reader.Storage.GetStats(id), time.Now())
+	assert.Equal(t, 2, stats.Delivered)
+	assert.Equal(t, 1, stats.Forwarded)
+}
+
+func TestStopGivesUpDeliveriesToTargets(t *testing.T) {
+	defer func(backoff []time.Duration) { targetBackoff = backoff }(targetBackoff)
+	targetBackoff = []time.Duration{time.Hour}
+
+	var receiver = &testTarget{failFirst: 10}
+	var server = httptest.NewServer(receiver)
+	defer server.Close()
+	reader, _, url := newTestReader(t, testFeeds{"/a": {2, 1}})
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	var id = feed.GetID()
+	target, err := NewTarget("Chat", server.URL, "", nil, "")
+	require.NoError(t, err)
+	require.NoError(t, reader.Storage.SaveFeedTargets(id, []storage.Target{target}, true))
+
+	reader.CheckFeed(id)
+	require.Eventually(t, func() bool {
+		receiver.lock.Lock()
+		defer receiver.lock.Unlock()
+		return receiver.requests == 1
+	}, time.Second, time.Millisecond)
+	// The first item is waiting out its retry and the second is queued behind it. Neither is tried again.
+	var stopped = make(chan struct{})
+	go func() {
+		reader.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not give up the retry")
+	}
+	assert.Equal(t, 1, receiver.requests)
+	stored, _ := reader.Storage.GetFeedByID(id).Target(target.ID)
+	assert.Equal(t, "/a 2", stored.Last.Title)
+	assert.Equal(t, errStopped.Error(), stored.Last.Error)
+}
+
+func TestRemoveTargetGivesUpItsDeliveries(t *testing.T) {
+	defer func(backoff []time.Duration) { targetBackoff = backoff }(targetBackoff)
+	targetBackoff = []time.Duration{time.Hour}
+
+	var receiver = &testTarget{failFirst: 10}
+	var server = httptest.NewServer(receiver)
+	defer server.Close()
+	reader, _, url := newTestReader(t, testFeeds{"/a": {2, 1}})
+	feed, _ := reader.Storage.SaveNewFeed(url+"/a", storage.FeedMeta{}, &storage.BacklogPolicy{Mode: storage.BacklogAll})
+	var id = feed.GetID()
+	target, err := NewTarget("Chat", server.URL, "", nil, "")
+	require.NoError(t, err)
+	require.NoError(t, reader.Storage.SaveFeedTargets(id, []storage.Target{target}, true))
+
+	reader.CheckFeed(id)
+	require.Eventually(t, func() bool {
+		receiver.lock.Lock()
+		defer receiver.lock.Unlock()
+		return receiver.requests == 1
+	}, time.Second, time.Millisecond)
+	_, err = reader.RemoveTarget(id, "missing")
+	assert.ErrorIs(t, err, storage.ErrTargetNotFound)
+	removed, err := reader.RemoveTarget(id, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, target.ID, removed.ID)
+	assert.Empty(t, reader.Storage.GetFeedByID(id).Targets)
+
+	// The retry is given up, the queued item is dropped and nothing is left of the queue.
+	var stopped = make(chan struct{})
+	go func() {
+		reader.forwarding.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("removing the target did not give up the retry")
+	}
+	assert.Equal(t, 1, receiver.requests)
+	_, found := reader.targetQueues.Load(targetQueueKey(id, target.ID))
+	assert.False(t, found)
+}
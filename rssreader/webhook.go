@@ -0,0 +1,254 @@
+package rssreader
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/events"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/mmcdole/gofeed"
+)
+
+var ErrWebhookUnauthorized = errors.New("invalid webhook token or signature")
+var ErrFeedPaused = errors.New("feed is paused or snoozed")
+
+var errWebhookHasNoUrl = errors.New("webhook feeds have no URL")
+
+// Wraps the errors of payloads that could not be turned into items.
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// NewWebhookToken returns a random token for the path of a webhook.
+func NewWebhookToken() string {
+	var token = make([]byte, 16)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// AddWebhookFeed creates a feed whose items are pushed to its webhook. A token is generated when the source has none.
+// The feed is returned even when saving failed, as it is kept in memory.
+func (rssreader *RSS_Reader) AddWebhookFeed(name string, source storage.WebhookSource, settings storage.FeedSettings) (*storage.Feed, error) {
+	if len(name) == 0 {
+		return nil, errors.New("a webhook feed needs a name")
+	}
+	if len(source.Token) == 0 {
+		source.Token = NewWebhookToken()
+	}
+	feed, err := rssreader.Storage.SaveNewFeed("", storage.FeedMeta{Title: name}, nil)
+	if feed == nil {
+		return nil, err
+	}
+	var id = feed.GetID()
+	err = errors.Join(err,
+		rssreader.Storage.SaveFeedWebhook(id, source),
+		rssreader.Storage.SaveFeedSettings(id, settings),
+	)
+	return rssreader.Storage.GetFeedByID(id), err
+}
+
+// ReceiveWebhook turns the body of a request to the webhook of a feed into items and delivers the new ones
+// the same way as the new items of a poll. It does not wait for them to be sent, so they are counted as queued.
+func (rssreader *RSS_Reader) ReceiveWebhook(id int, token string, header http.Header, body []byte) (PollSummary, error) {
+	var summary = PollSummary{Errors: []string{}}
+	var feedRecord = rssreader.Storage.GetFeedByID(id)
+	if feedRecord == nil || feedRecord.Webhook == nil {
+		return summary, storage.ErrFeedNotFound
+	}
+	if err := verifyWebhook(*feedRecord.Webhook, token, header, body); err != nil {
+		rssreader.logger.Warn("Rejected webhook request", logging.Feed(id), "error", err)
+		return summary, err
+	}
+
+	rssreader.pollLock.Lock()
+	defer rssreader.pollLock.Unlock()
+
+	var loadError storage.LoadError
+	if errors.As(rssreader.Storage.Error(), &loadError) {
+		rssreader.logger.Error("Skipping webhook request", logging.Feed(id), "error", loadError)
+		return summary, loadError
+	}
+	// Read again after taking the lock so that what a previous request recorded is seen.
+	feedRecord = rssreader.Storage.GetFeedByID(id)
+	if feedRecord == nil {
+		return summary, storage.ErrFeedNotFound
+	}
+	var now = time.Now()
+	if feedRecord.Paused || feedRecord.IsSnoozed(now) {
+		summary.Skipped++
+		return summary, ErrFeedPaused
+	}
+
+	rssreader.events.Publish(events.About(events.PollStart, id, ""))
+	items, err := WebhookItems(feedRecord.Webhook.Mapping, body)
+	var stats = storage.PollStats{Failed: err != nil, Bytes: int64(len(body))}
+	if pollError := rssreader.Storage.SaveFeedPolled(id, now); pollError != nil {
+		rssreader.logger.Error("Failed to record poll", logging.Feed(id), "error", pollError)
+	}
+	rssreader.recordHealth(feedRecord, err, now)
+	if err != nil {
+		if statsError := rssreader.Storage.RecordStats(id, now, stats); statsError != nil {
+			rssreader.logger.Error("Failed to record statistics", logging.Feed(id), "error", statsError)
+		}
+		rssreader.logger.Warn("Failed to read webhook request", logging.Feed(id), "error", err)
+		rssreader.events.Publish(events.About(events.PollFinish, id, ""))
+		return summary, err
+	}
+
+	var feed = &gofeed.Feed{Title: feedRecord.Meta.Title, Description: feedRecord.Meta.Description, Link: feedRecord.Meta.SiteLink, Items: items}
+	var groups = rssreader.Storage.GetGroups()
+	var settings = rssreader.Storage.GetSettings()
+	var result = rssreader.findNewItems(id, feedRecord, feed, settings, storage.ResolveSettings(feedRecord, groups[feedRecord.Group], settings), now)
+	result.stats = stats
+	rssreader.logger.Debug("Received webhook request", logging.Feed(id), "found", len(items), "new", result.newCount, "bytes", len(body))
+	summary.Feeds++
+	summary.Found += len(items)
+	summary.New += result.newCount
+	// The sender may be waiting out the rate limit, which the sender of the request is not kept waiting for.
+	rssreader.queueSends(rssreader.context(), []*feedPoll{result}, result.toSend, []int{id}, &summary, now).summarize(&summary, false)
+	return summary, nil
+}
+
+// Checks the token of the request and, when the source has a secret, the signature of the body.
+func verifyWebhook(source storage.WebhookSource, token string, header http.Header, body []byte) error {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(source.Token)) != 1 {
+		return ErrWebhookUnauthorized
+	}
+	if len(source.Secret) == 0 {
+		return nil
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(header.Get(source.Header())), "sha256="))
+	if err != nil || len(signature) == 0 {
+		return ErrWebhookUnauthorized
+	}
+	var mac = hmac.New(sha256.New, []byte(source.Secret))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return ErrWebhookUnauthorized
+	}
+	return nil
+}
+
+// WebhookItems maps a JSON payload into items.
+func WebhookItems(mapping storage.WebhookMapping, body []byte) ([]*gofeed.Item, error) {
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+	var values = []any{payload}
+	if len(mapping.Items) != 0 {
+		found, ok := lookupPath(payload, mapping.Items)
+		list, isList := found.([]any)
+		if !ok || !isList {
+			return nil, fmt.Errorf("%w: no array at %q", ErrInvalidPayload, mapping.Items)
+		}
+		values = list
+	}
+
+	var items = []*gofeed.Item{}
+	for index, value := range values {
+		item, err := webhookItem(mapping, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: item %d: %w", ErrInvalidPayload, index, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func webhookItem(mapping storage.WebhookMapping, value any) (*gofeed.Item, error) {
+	var field = func(path string) string {
+		if len(path) == 0 {
+			return ""
+		}
+		found, _ := lookupPath(value, path)
+		return strings.TrimSpace(stringify(found))
+	}
+	var item = &gofeed.Item{
+		Title:       field(mapping.Title),
+		Description: field(mapping.Description),
+		Link:        field(mapping.Link),
+		GUID:        field(mapping.ID),
+		Published:   field(mapping.Published),
+	}
+	if len(item.Title) == 0 && len(item.Description) == 0 {
+		return nil, errors.New("neither a title nor a description was found")
+	}
+	if author := field(mapping.Author); len(author) != 0 {
+		item.Authors = []*gofeed.Person{{Name: author}}
+	}
+	if len(item.Published) != 0 {
+		published, err := parseWebhookTime(item.Published)
+		if err != nil {
+			return nil, err
+		}
+		item.PublishedParsed = &published
+	}
+	if len(item.GUID) == 0 {
+		// Maps are encoded with sorted keys so the same content always gives the same ID.
+		encoded, _ := json.Marshal(value)
+		var sum = sha256.Sum256(encoded)
+		item.GUID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return item, nil
+}
+
+// Parses an RFC 3339 time or unix seconds.
+func parseWebhookTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(int64(seconds), 0), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return parsed, nil
+}
+
+// Finds the value at a path of keys and array indexes separated by dots.
+func lookupPath(value any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch container := value.(type) {
+		case map[string]any:
+			found, ok := container[key]
+			if !ok {
+				return nil, false
+			}
+			value = found
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(container) {
+				return nil, false
+			}
+			value = container[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// The text of a JSON value. Objects and arrays are kept as JSON.
+func stringify(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(typed)
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
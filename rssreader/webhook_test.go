@@ -0,0 +1,104 @@
+package rssreader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookItems(t *testing.T) {
+	var mapping = storage.WebhookMapping{Items: "builds", Title: "name", Description: "result.status", Link: "links.0", ID: "id", Published: "at"}
+	items, err := WebhookItems(mapping, []byte(`{"builds": [
+		{"id": 7, "name": "Build 7", "result": {"status": "passed"}, "links": ["https://ci.example.com/7"], "at": "2024-03-01T10:00:00Z"},
+		{"id": 8, "name": "Build 8", "result": {"status": false}, "at": 1709290800}
+	]}`))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "7", items[0].GUID)
+	assert.Equal(t, "Build 7", items[0].Title)
+	assert.Equal(t, "passed", items[0].Description)
+	assert.Equal(t, "https://ci.example.com/7", items[0].Link)
+	assert.Equal(t, "2024-03-01T10:00:00Z", items[0].PublishedParsed.UTC().Format("2006-01-02T15:04:05Z"))
+	assert.Equal(t, "false", items[1].Description)
+	assert.Equal(t, "", items[1].Link)
+	assert.Equal(t, int64(1709290800), items[1].PublishedParsed.Unix())
+
+	// Without an ID the same content gets the same ID whatever the order of its keys.
+	var byContent = storage.DefaultWebhookMapping()
+	first, err := WebhookItems(byContent, []byte(`{"title": "Door opened", "room": "hall"}`))
+	require.NoError(t, err)
+	second, err := WebhookItems(byContent, []byte(`{"room": "hall", "title": "Door opened"}`))
+	require.NoError(t, err)
+	assert.Equal(t, first[0].GUID, second[0].GUID)
+
+	for _, body := range []string{`not json`, `{"room": "hall"}`, `{"title": "x", "at": "yesterday"}`} {
+		_, err = WebhookItems(storage.WebhookMapping{Title: "title", Published: "at"}, []byte(body))
+		assert.ErrorIs(t, err, ErrInvalidPayload, body)
+	}
+	_, err = WebhookItems(mapping, []byte(`{"builds": {"id": 7}}`))
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	var body = []byte(`{"title": "Hello"}`)
+	var mac = hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	var signature = hex.EncodeToString(mac.Sum(nil))
+
+	var source = storage.WebhookSource{Token: "token"}
+	assert.NoError(t, verifyWebhook(source, "token", http.Header{}, body))
+	assert.ErrorIs(t, verifyWebhook(source, "other", http.Header{}, body), ErrWebhookUnauthorized)
+
+	source.Secret = "secret"
+	assert.ErrorIs(t, verifyWebhook(source, "token", http.Header{}, body), ErrWebhookUnauthorized)
+	assert.NoError(t, verifyWebhook(source, "token", http.Header{"X-Hub-Signature-256": {"sha256=" + signature}}, body))
+	assert.ErrorIs(t, verifyWebhook(source, "token", http.Header{"X-Hub-Signature-256": {signature}}, []byte(`{}`)), ErrWebhookUnauthorized)
+
+	source.SignatureHeader = "X-Signature"
+	assert.NoError(t, verifyWebhook(source, "token", http.Header{"X-Signature": {signature}}, body))
+}
+
+func TestReceiveWebhook(t *testing.T) {
+	reader, messages, _ := newTestReader(t, testFeeds{})
+	feed, err := reader.AddWebhookFeed("Doorbell", storage.WebhookSource{Mapping: storage.DefaultWebhookMapping()}, storage.FeedSettings{})
+	require.NoError(t, err)
+	var id = feed.GetID()
+	var token = feed.Webhook.Token
+	assert.Len(t, token, 32)
+
+	summary, err := reader.ReceiveWebhook(id, token, http.Header{}, []byte(`{"title": "Ring", "message": "Front door"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.New)
+	reader.sending.Wait()
+	assert.Equal(t, []string{"Front door"}, links(messages.sent))
+
+	// The same item again is not sent twice, even with no link or date to tell it by.
+	summary, err = reader.ReceiveWebhook(id, token, http.Header{}, []byte(`{"message": "Front door", "title": "Ring"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, summary.New)
+	_, err = reader.ReceiveWebhook(id, token, http.Header{}, []byte(`{"title": "Ring", "message": "Back door"}`))
+	require.NoError(t, err)
+	reader.sending.Wait()
+	assert.Equal(t, []string{"Front door", "Back door"}, links(messages.sent))
+	assert.Len(t, reader.Storage.GetDeliveries(id), 2)
+
+	_, err = reader.ReceiveWebhook(id, "wrong", http.Header{}, []byte(`{"title": "Ring"}`))
+	assert.ErrorIs(t, err, ErrWebhookUnauthorized)
+	_, err = reader.ReceiveWebhook(id, token, http.Header{}, []byte(`{"room": "hall"}`))
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+	assert.Equal(t, 1, reader.Storage.GetFeedByID(id).Failures)
+
+	require.NoError(t, reader.Storage.PauseFeed(id, "paused manually"))
+	_, err = reader.ReceiveWebhook(id, token, http.Header{}, []byte(`{"title": "Knock"}`))
+	assert.ErrorIs(t, err, ErrFeedPaused)
+	assert.Len(t, messages.sent, 2)
+
+	// Webhook feeds are never polled.
+	assert.Equal(t, 0, reader.CheckAllNow().Feeds)
+}
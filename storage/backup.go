@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+)
+
+// What an import changed.
+type ImportSummary struct {
+	Added   int
+	Updated int
+	Removed int
+}
+
+func (storage *store) Export() ([]byte, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return nil, err
+	}
+	var export = storage.innerStore
+	export.SchemaVersion = SchemaVersion
+	export.Backup = nil
+	return json.MarshalIndent(export, "", "  ")
+}
+
+func (storage *store) Import(data []byte, replace bool) (ImportSummary, error) {
+	var summary ImportSummary
+	data, _, err := migrate(data)
+	if err != nil {
+		return summary, fmt.Errorf("invalid backup: %w", err)
+	}
+	var imported innerStorageStruct
+	err = json.Unmarshal(data, &imported)
+	if err != nil {
+		return summary, fmt.Errorf("invalid backup: %w", err)
+	}
+	imported.normalize()
+	for id, feed := range imported.Feeds {
+		if feed.Webhook != nil {
+			if len(feed.Webhook.Token) == 0 {
+				return summary, fmt.Errorf("invalid backup: webhook feed %d has no token", id)
+			}
+			continue
+		}
+		parsed, err := url.Parse(feed.Url)
+		if err != nil || len(parsed.Host) == 0 {
+			return summary, fmt.Errorf("invalid backup: feed %d has an invalid URL %q", id, feed.Url)
+		}
+	}
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return summary, err
+	}
+
+	// Feeds can only be in a group that exists. A group missing from the backup is dropped, as it is on removal.
+	for id, feed := range imported.Feeds {
+		if len(feed.Group) != 0 && imported.Groups[feed.Group] == nil && (replace || storage.innerStore.Groups[feed.Group] == nil) {
+			storage.logger.Warn("Dropped unknown group of imported feed", logging.Feed(id), "group", feed.Group)
+			feed.Group = ""
+		}
+	}
+
+	if replace {
+		// Deliveries and statistics of feeds missing from the backup would be taken up by the next feed given their ID.
+		for id := range imported.Deliveries {
+			if imported.Feeds[id] == nil {
+				delete(imported.Deliveries, id)
+			}
+		}
+		for id := range imported.FeedStats {
+			if imported.Feeds[id] == nil {
+				delete(imported.FeedStats, id)
+			}
+		}
+		summary.Removed = len(storage.innerStore.Feeds)
+		summary.Added = len(imported.Feeds)
+		imported.Backup = storage.innerStore.Backup
+		imported.NextID = max(imported.NextID, storage.innerStore.NextID)
+		storage.innerStore = imported
+		storage.logger.Info("Replaced all feeds and settings with a backup", "feeds", summary.Added)
+		return summary, storage.changed()
+	}
+
+	var byUrl = map[string]*Feed{}
+	for _, feed := range storage.innerStore.Feeds {
+		byUrl[importKey(feed)] = feed
+	}
+	for _, id := range sortedIDs(imported.Feeds) {
+		var importedFeed = imported.Feeds[id]
+		var existing = byUrl[importKey(importedFeed)]
+		if existing == nil {
+			var newID = storage.nextFeedID()
+			importedFeed.id = newID
+			storage.innerStore.Feeds[newID] = importedFeed
+			byUrl[importKey(importedFeed)] = importedFeed
+			summary.Added++
+			continue
+		}
+
+		for itemUrl := range importedFeed.ItemUrls {
+			existing.ItemUrls[itemUrl] = true
+		}
+		if importedFeed.LastDate != nil && (existing.LastDate == nil || existing.LastDate.Before(*importedFeed.LastDate)) {
+			existing.LastDate = importedFeed.LastDate
+		}
+		if !existing.Meta.UpdatedAt.After(importedFeed.Meta.UpdatedAt) {
+			existing.Meta = importedFeed.Meta
+		}
+		existing.DisplayName = importedFeed.DisplayName
+		existing.Settings = importedFeed.Settings
+		existing.Group = importedFeed.Group
+		existing.Tags = importedFeed.Tags
+		existing.Paused = importedFeed.Paused
+		existing.PauseReason = importedFeed.PauseReason
+		existing.SnoozedUntil = importedFeed.SnoozedUntil
+		existing.Webhook = importedFeed.Webhook
+		existing.Targets = importedFeed.Targets
+		existing.TargetsOnly = importedFeed.TargetsOnly
+		summary.Updated++
+	}
+	for name, group := range imported.Groups {
+		storage.innerStore.Groups[name] = group
+	}
+	if len(storage.innerStore.ClientToken) == 0 {
+		storage.innerStore.ClientToken = imported.ClientToken
+	}
+	if storage.innerStore.Settings == nil {
+		storage.innerStore.Settings = imported.Settings
+	}
+	storage.logger.Info("Merged backup", "added", summary.Added, "updated", summary.Updated)
+	return summary, storage.changed()
+}
+
+// Feeds are merged with the feed of the same URL. Webhook feeds have no URL so their token is used instead.
+func importKey(feed *Feed) string {
+	if feed.Webhook != nil {
+		return "webhook:" + feed.Webhook.Token
+	}
+	return feed.Url
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+)
+
+// RemoveFeedsByID removes every given feed. Nothing is removed when any of them does not exist.
+func (storage *store) RemoveFeedsByID(ids []int) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if storage.innerStore.Feeds[id] == nil {
+			return fmt.Errorf("feed %d: %w", id, ErrFeedNotFound)
+		}
+	}
+	for _, id := range ids {
+		if storage.innerStore.Feeds[id] == nil {
+			// Listed twice.
+			continue
+		}
+		storage.logger.Info("Deleted Feed", logging.Feed(id), "url", storage.innerStore.Feeds[id].Url)
+		delete(storage.innerStore.Feeds, id)
+		delete(storage.innerStore.Deliveries, id)
+		delete(storage.innerStore.FeedStats, id)
+	}
+	return storage.changed()
+}
+
+// SaveFeedUrls points every given feed at its new URL, keeping what has been seen. Nothing is changed when any of
+// the feeds does not exist or two feeds would end up with the same URL.
+func (storage *store) SaveFeedUrls(urls map[int]string) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	// Number of feeds with each URL once the feeds are moved.
+	var taken = map[string]int{}
+	for id, feed := range storage.innerStore.Feeds {
+		if url, moving := urls[id]; moving {
+			taken[url]++
+		} else {
+			taken[feed.Url]++
+		}
+	}
+	for _, id := range sortedIntKeys(urls) {
+		if storage.innerStore.Feeds[id] == nil {
+			return fmt.Errorf("feed %d: %w", id, ErrFeedNotFound)
+		}
+		if taken[urls[id]] > 1 {
+			return fmt.Errorf("more than one feed would have the URL %s", urls[id])
+		}
+	}
+	for _, id := range sortedIntKeys(urls) {
+		var feed = storage.innerStore.Feeds[id]
+		storage.logger.Info("Moved Feed", logging.Feed(id), "from", feed.Url, "to", urls[id])
+		feed.Url = urls[id]
+		feed.ETag = ""
+		feed.LastModified = ""
+	}
+	return storage.changed()
+}
+
+func sortedIntKeys(values map[int]string) []int {
+	var keys = make([]int, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
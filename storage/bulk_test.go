@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveFeedsByIDIsAllOrNothing(t *testing.T) {
+	var storage = NewMemoryStorage(testLogger)
+	first, _ := storage.SaveNewFeed("https://example.com/a", FeedMeta{}, nil)
+	second, _ := storage.SaveNewFeed("https://example.com/b", FeedMeta{}, nil)
+
+	assert.ErrorIs(t, storage.RemoveFeedsByID([]int{first.GetID(), 42}), ErrFeedNotFound)
+	assert.Len(t, storage.GetFeeds(), 2)
+
+	assert.NoError(t, storage.RemoveFeedsByID([]int{first.GetID(), second.GetID()}))
+	assert.Empty(t, storage.GetFeeds())
+}
+
+func TestSaveFeedUrlsIsAllOrNothing(t *testing.T) {
+	var storage = NewMemoryStorage(testLogger)
+	first, _ := storage.SaveNewFeed("https://old.example.com/a", FeedMeta{}, nil)
+	second, _ := storage.SaveNewFeed("https://old.example.com/b", FeedMeta{}, nil)
+	third, _ := storage.SaveNewFeed("https://new.example.com/a", FeedMeta{}, nil)
+	storage.SaveITemUrlsAndLatestDate(first.GetID(), first.Url, []string{"https://example.com/post"}, nil)
+
+	// The first feed would take the URL of the third.
+	var err = storage.SaveFeedUrls(map[int]string{first.GetID(): "https://new.example.com/a", second.GetID(): "https://new.example.com/b"})
+	assert.Error(t, err)
+	assert.Equal(t, "https://old.example.com/b", storage.GetFeedByID(second.GetID()).Url)
+
+	// Swapping URLs is fine.
+	assert.NoError(t, storage.SaveFeedUrls(map[int]string{first.GetID(): "https://new.example.com/a", third.GetID(): "https://old.example.com/a"}))
+	assert.Equal(t, "https://new.example.com/a", storage.GetFeedByID(first.GetID()).Url)
+	assert.True(t, storage.GetFeedByID(first.GetID()).ItemUrls["https://example.com/post"])
+	assert.Equal(t, "https://old.example.com/a", storage.GetFeedByID(third.GetID()).Url)
+}
@@ -0,0 +1,78 @@
+package storage
+
+import "time"
+
+// Number of deliveries kept per feed.
+const deliveryLogSize = 200
+
+// Outcomes of a delivery.
+const (
+	// Sent to Gotify.
+	DeliverySent = "sent"
+	// Marked as seen without being sent, such as items skipped by the backlog policy or the breaker.
+	DeliveryFiltered = "filtered"
+	// Over the items per poll limit so only counted in a summary message. Can be resent.
+	DeliveryDeferred = "deferred"
+	// Sending to Gotify failed.
+	DeliveryFailed = "failed"
+	// Left to the targets of a feed that does not send to Gotify. Their outcomes are kept with the targets.
+	DeliveryForwarded = "forwarded"
+)
+
+// A record of what happened to an item of a feed.
+type Delivery struct {
+	// GUID of the item, falling back to its link.
+	ItemID      string
+	Title       string
+	Link        string
+	SeenAt      time.Time
+	DeliveredAt *time.Time `json:",omitempty"`
+	// ID of the Gotify message. Only known when sent with an application token.
+	MessageID int `json:",omitempty"`
+	Status    string
+	Error     string `json:",omitempty"`
+}
+
+func (storage *store) RecordDeliveries(id int, deliveries []Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	if storage.innerStore.Feeds[id] == nil {
+		return ErrFeedNotFound
+	}
+	if storage.innerStore.Deliveries == nil {
+		storage.innerStore.Deliveries = make(map[int][]Delivery)
+	}
+	var log = append(storage.innerStore.Deliveries[id], deliveries...)
+	if len(log) > deliveryLogSize {
+		log = append([]Delivery(nil), log[len(log)-deliveryLogSize:]...)
+	}
+	storage.innerStore.Deliveries[id] = log
+	return storage.changed()
+}
+
+func (storage *store) GetDeliveries(id int) []Delivery {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.load()
+	var deliveries = make([]Delivery, len(storage.innerStore.Deliveries[id]))
+	for index, delivery := range storage.innerStore.Deliveries[id] {
+		delivery.DeliveredAt = copyPointer(delivery.DeliveredAt)
+		deliveries[index] = delivery
+	}
+	return deliveries
+}
+
+func (storage *store) MarkItemUnseen(id int, link string) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		if feed.Unseen == nil {
+			feed.Unseen = make(map[string]bool)
+		}
+		feed.Unseen[link] = true
+	})
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrGroupNotFound = errors.New("group not found")
+
+// FeedSettings override the settings inherited from the group of a feed or the global settings. Nil values are inherited.
+type FeedSettings struct {
+	PollMinutes     *int
+	Priority        *int
+	AppToken        *string
+	MaxItemsPerPoll *int
+}
+
+func (settings FeedSettings) copy() FeedSettings {
+	return FeedSettings{
+		PollMinutes:     copyPointer(settings.PollMinutes),
+		Priority:        copyPointer(settings.Priority),
+		AppToken:        copyPointer(settings.AppToken),
+		MaxItemsPerPoll: copyPointer(settings.MaxItemsPerPoll),
+	}
+}
+
+// Group collects feeds under a name. Its settings are the defaults of its feeds.
+type Group struct {
+	Name     string
+	Settings FeedSettings
+}
+
+// Effective is the value of a setting for a feed and where it came from.
+type Effective[T any] struct {
+	Value T
+	// "feed", "group" or "default".
+	Source string
+}
+
+// EffectiveSettings are the settings that apply to a feed once inherited values are filled in.
+type EffectiveSettings struct {
+	PollMinutes     Effective[int]
+	Priority        Effective[int]
+	AppToken        Effective[string]
+	MaxItemsPerPoll Effective[int]
+}
+
+func (effective EffectiveSettings) PollInterval() time.Duration {
+	return time.Duration(effective.PollMinutes.Value) * time.Minute
+}
+
+// ResolveSettings works out the settings of the feed from its own, those of its group (which may be nil) and the global settings.
+func ResolveSettings(feed *Feed, group *Group, settings Settings) EffectiveSettings {
+	var groupSettings FeedSettings
+	if group != nil {
+		groupSettings = group.Settings
+	}
+	if settings.PollMinutes <= 0 {
+		settings.PollMinutes = DefaultSettings().PollMinutes
+	}
+	return EffectiveSettings{
+		PollMinutes:     resolve(feed.Settings.PollMinutes, groupSettings.PollMinutes, settings.PollMinutes),
+		Priority:        resolve(feed.Settings.Priority, groupSettings.Priority, settings.Priority),
+		AppToken:        resolve(feed.Settings.AppToken, groupSettings.AppToken, settings.AppToken),
+		MaxItemsPerPoll: resolve(feed.Settings.MaxItemsPerPoll, groupSettings.MaxItemsPerPoll, settings.MaxItemsPerPoll),
+	}
+}
+
+func resolve[T any](feedValue *T, groupValue *T, defaultValue T) Effective[T] {
+	if feedValue != nil {
+		return Effective[T]{Value: *feedValue, Source: "feed"}
+	}
+	if groupValue != nil {
+		return Effective[T]{Value: *groupValue, Source: "group"}
+	}
+	return Effective[T]{Value: defaultValue, Source: "default"}
+}
+
+// Splits comma separated tags, dropping blanks and duplicates.
+func ParseTags(tags string) []string {
+	var parsed = []string{}
+	var seen = map[string]bool{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) != 0 && !seen[tag] {
+			seen[tag] = true
+			parsed = append(parsed, tag)
+		}
+	}
+	return parsed
+}
+
+func (storage *store) GetGroups() map[string]*Group {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.load()
+	var groups = make(map[string]*Group, len(storage.innerStore.Groups))
+	for name, group := range storage.innerStore.Groups {
+		groups[name] = &Group{Name: group.Name, Settings: group.Settings.copy()}
+	}
+	return groups
+}
+
+func (storage *store) SaveGroup(group Group) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if len(group.Name) == 0 {
+		return errors.New("a group needs a name")
+	}
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	storage.innerStore.Groups[group.Name] = &Group{Name: group.Name, Settings: group.Settings.copy()}
+	return storage.changed()
+}
+
+func (storage *store) RemoveGroup(name string) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	if storage.innerStore.Groups[name] == nil {
+		return ErrGroupNotFound
+	}
+	delete(storage.innerStore.Groups, name)
+	for _, feed := range storage.innerStore.Feeds {
+		if feed.Group == name {
+			feed.Group = ""
+		}
+	}
+	storage.logger.Info("Deleted Group", "group", name)
+	return storage.changed()
+}
+
+func (storage *store) SaveFeedGroupAndTags(id int, group string, tags []string) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	var feed = storage.innerStore.Feeds[id]
+	if feed == nil {
+		return ErrFeedNotFound
+	}
+	if len(group) != 0 && storage.innerStore.Groups[group] == nil {
+		return ErrGroupNotFound
+	}
+	feed.Group = group
+	feed.Tags = append([]string(nil), tags...)
+	return storage.changed()
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSettings(t *testing.T) {
+	var feedPriority, groupPriority, groupPoll = 8, 4, 30
+	var feed = &Feed{Settings: FeedSettings{Priority: &feedPriority}}
+	var group = &Group{Name: "News", Settings: FeedSettings{Priority: &groupPriority, PollMinutes: &groupPoll}}
+	var settings = DefaultSettings()
+
+	var effective = ResolveSettings(feed, group, settings)
+	assert.Equal(t, Effective[int]{Value: 8, Source: "feed"}, effective.Priority)
+	assert.Equal(t, Effective[int]{Value: 30, Source: "group"}, effective.PollMinutes)
+	assert.Equal(t, Effective[int]{Value: settings.MaxItemsPerPoll, Source: "default"}, effective.MaxItemsPerPoll)
+
+	effective = ResolveSettings(feed, nil, Settings{})
+	assert.Equal(t, DefaultSettings().PollMinutes, effective.PollMinutes.Value)
+}
+
+func TestRemoveGroupUngroupsFeeds(t *testing.T) {
+	var storage = NewMemoryStorage(testLogger)
+	assert.NoError(t, storage.SaveGroup(Group{Name: "News"}))
+	feed, err := storage.SaveNewFeed("https://example.com/feed", FeedMeta{}, nil)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, storage.SaveFeedGroupAndTags(feed.GetID(), "Missing", nil), ErrGroupNotFound)
+	assert.NoError(t, storage.SaveFeedGroupAndTags(feed.GetID(), "News", ParseTags("a, b,,a")))
+
+	feed = storage.GetFeedByID(feed.GetID())
+	assert.Equal(t, "News", feed.Group)
+	assert.Equal(t, []string{"a", "b"}, feed.Tags)
+
+	assert.NoError(t, storage.RemoveGroup("News"))
+	feed = storage.GetFeedByID(feed.GetID())
+	assert.Empty(t, feed.Group)
+	assert.Empty(t, storage.GetGroups())
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version of the stored data written by this build. Bump it together with a new entry in migrations.
+const SchemaVersion = 1
+
+// Upgrades the raw stored data by one version. The data is keyed by the fields of innerStorageStruct.
+type migration func(data map[string]json.RawMessage) error
+
+// Ordered so that migrations[n] upgrades data from version n to version n+1.
+var migrations = []migration{
+	// Data stored before versioning. The layout is unchanged so only the version is added.
+	func(data map[string]json.RawMessage) error { return nil },
+}
+
+// Copy of the stored data as it was before the last migration.
+type SchemaBackup struct {
+	Version    int
+	MigratedAt time.Time
+	Data       json.RawMessage
+}
+
+type SchemaTooNewError struct {
+	Version int
+}
+
+func (err SchemaTooNewError) Error() string {
+	return fmt.Sprintf("stored data is schema version %d but this version of the plugin only supports up to version %d. Update the plugin or restore a backup", err.Version, SchemaVersion)
+}
+
+// Brings the stored data up to SchemaVersion. Returns whether anything was migrated.
+func migrate(storageBytes []byte) ([]byte, bool, error) {
+	var data map[string]json.RawMessage
+	err := json.Unmarshal(storageBytes, &data)
+	if err != nil {
+		return storageBytes, false, err
+	}
+
+	var version = 0
+	if rawVersion, present := data["SchemaVersion"]; present {
+		err = json.Unmarshal(rawVersion, &version)
+		if err != nil {
+			return storageBytes, false, fmt.Errorf("invalid schema version: %w", err)
+		}
+	}
+	if version > SchemaVersion {
+		return storageBytes, false, SchemaTooNewError{Version: version}
+	}
+	if version == SchemaVersion {
+		return storageBytes, false, nil
+	}
+
+	// Only the data from directly before this migration is kept to stop backups nesting.
+	delete(data, "Backup")
+	previous, err := json.Marshal(data)
+	if err != nil {
+		return storageBytes, false, err
+	}
+
+	var fromVersion = version
+	for ; version < SchemaVersion; version++ {
+		err = migrations[version](data)
+		if err != nil {
+			return storageBytes, false, fmt.Errorf("migrating from schema version %d: %w", version, err)
+		}
+	}
+
+	backup, err := json.Marshal(SchemaBackup{Version: fromVersion, MigratedAt: time.Now(), Data: previous})
+	if err != nil {
+		return storageBytes, false, err
+	}
+	data["Backup"] = backup
+	data["SchemaVersion"], _ = json.Marshal(SchemaVersion)
+
+	migrated, err := json.Marshal(data)
+	if err != nil {
+		return storageBytes, false, err
+	}
+	return migrated, true, nil
+}
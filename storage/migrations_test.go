@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateUnversionedData(t *testing.T) {
+	var old = []byte(`{"ClientToken":"token","NextID":0,"Feeds":{"0":{"Url":"https://example.com/feed"}}}`)
+
+	migrated, changed, err := migrate(old)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	var store innerStorageStruct
+	assert.NoError(t, json.Unmarshal(migrated, &store))
+	assert.Equal(t, SchemaVersion, store.SchemaVersion)
+	assert.Equal(t, "token", store.ClientToken)
+	assert.Equal(t, "https://example.com/feed", store.Feeds[0].Url)
+	if assert.NotNil(t, store.Backup) {
+		assert.Equal(t, 0, store.Backup.Version)
+		assert.JSONEq(t, string(old), string(store.Backup.Data))
+	}
+}
+
+func TestMigrateCurrentData(t *testing.T) {
+	var current, _ = json.Marshal(innerStorageStruct{SchemaVersion: SchemaVersion})
+
+	migrated, changed, err := migrate(current)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, current, migrated)
+}
+
+func TestMigrateNewerData(t *testing.T) {
+	var newer, _ = json.Marshal(innerStorageStruct{SchemaVersion: SchemaVersion + 1})
+
+	_, changed, err := migrate(newer)
+	assert.False(t, changed)
+	assert.ErrorAs(t, err, &SchemaTooNewError{})
+}
@@ -0,0 +1,207 @@
+package storage
+
+import "time"
+
+// Number of days of statistics kept.
+const StatsDays = 30
+
+// Upper bounds of the fetch latency histogram buckets. The last bucket counts everything slower.
+var LatencyBounds = []time.Duration{
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Layout of the day of a DailyStats.
+const statsDayLayout = "2006-01-02"
+
+// PollStats is what a single poll of a feed observed.
+type PollStats struct {
+	// The feed answered that it had not changed since the last fetch.
+	NotModified bool
+	// The feed could not be fetched or parsed.
+	Failed    bool
+	Bytes     int64
+	Latency   time.Duration
+	NewItems  int
+	Filtered  int
+	Deferred  int
+	Delivered int
+	// Items of feeds that do not send to Gotify, handed to their targets. Whether the targets took them is in the target results.
+	Forwarded int
+	// Items that failed to send.
+	SendFailures int
+}
+
+// DailyStats adds up the polls of a day.
+type DailyStats struct {
+	// The local date, such as 2024-03-01.
+	Day         string
+	Polls       int
+	NotModified int
+	// Polls where the feed could not be fetched or parsed.
+	ParseErrors  int
+	Bytes        int64
+	NewItems     int
+	Filtered     int
+	Deferred     int
+	Delivered    int
+	Forwarded    int
+	SendFailures int
+	// Sum of the fetch latencies, for the average.
+	LatencyMs int64
+	// Number of fetches in each bucket of LatencyBounds, plus one for slower fetches.
+	Latency []int `json:",omitempty"`
+}
+
+// StatsDay returns the day of the given time as used by DailyStats.
+func StatsDay(at time.Time) string {
+	return at.Local().Format(statsDayLayout)
+}
+
+func (stats *DailyStats) add(poll PollStats) {
+	stats.Polls++
+	if poll.NotModified {
+		stats.NotModified++
+	}
+	if poll.Failed {
+		stats.ParseErrors++
+	}
+	stats.Bytes += poll.Bytes
+	stats.NewItems += poll.NewItems
+	stats.Filtered += poll.Filtered
+	stats.Deferred += poll.Deferred
+	stats.Delivered += poll.Delivered
+	stats.Forwarded += poll.Forwarded
+	stats.SendFailures += poll.SendFailures
+	stats.LatencyMs += poll.Latency.Milliseconds()
+	if len(stats.Latency) != len(LatencyBounds)+1 {
+		stats.Latency = append(stats.Latency, make([]int, len(LatencyBounds)+1-len(stats.Latency))...)
+	}
+	var bucket = 0
+	for bucket < len(LatencyBounds) && poll.Latency > LatencyBounds[bucket] {
+		bucket++
+	}
+	stats.Latency[bucket]++
+}
+
+// Plus returns the sum of both stats, keeping the day of the receiver.
+func (stats DailyStats) Plus(other DailyStats) DailyStats {
+	var sum = stats
+	sum.Polls += other.Polls
+	sum.NotModified += other.NotModified
+	sum.ParseErrors += other.ParseErrors
+	sum.Bytes += other.Bytes
+	sum.NewItems += other.NewItems
+	sum.Filtered += other.Filtered
+	sum.Deferred += other.Deferred
+	sum.Delivered += other.Delivered
+	sum.Forwarded += other.Forwarded
+	sum.SendFailures += other.SendFailures
+	sum.LatencyMs += other.LatencyMs
+	sum.Latency = make([]int, len(LatencyBounds)+1)
+	for index := range sum.Latency {
+		if index < len(stats.Latency) {
+			sum.Latency[index] += stats.Latency[index]
+		}
+		if index < len(other.Latency) {
+			sum.Latency[index] += other.Latency[index]
+		}
+	}
+	return sum
+}
+
+// AverageLatency of the polls. Zero without polls.
+func (stats DailyStats) AverageLatency() time.Duration {
+	if stats.Polls == 0 {
+		return 0
+	}
+	return time.Duration(stats.LatencyMs/int64(stats.Polls)) * time.Millisecond
+}
+
+// StatsSince adds up the days on or after the day of the given time.
+func StatsSince(days []DailyStats, since time.Time) DailyStats {
+	var first = StatsDay(since)
+	var total = DailyStats{Day: first}
+	for _, day := range days {
+		if day.Day >= first {
+			total = total.Plus(day)
+		}
+	}
+	return total
+}
+
+// StatsSeries returns the given number of days up to and including the day of now, oldest first.
+// Days without polls are left at zero.
+func StatsSeries(days []DailyStats, now time.Time, count int) []DailyStats {
+	var byDay = make(map[string]DailyStats, len(days))
+	for _, day := range days {
+		byDay[day.Day] = day
+	}
+	var series = make([]DailyStats, count)
+	for index := range series {
+		var day = StatsDay(now.AddDate(0, 0, index-count+1))
+		series[index] = byDay[day]
+		series[index].Day = day
+	}
+	return series
+}
+
+// Adds the poll to the bucket of its day, dropping days past StatsDays.
+func addToStats(days []DailyStats, at time.Time, poll PollStats) []DailyStats {
+	var day = StatsDay(at)
+	if len(days) == 0 || days[len(days)-1].Day != day {
+		days = append(days, DailyStats{Day: day})
+	}
+	days[len(days)-1].add(poll)
+	var oldest = StatsDay(at.AddDate(0, 0, -StatsDays+1))
+	var keepFrom = 0
+	for keepFrom < len(days) && days[keepFrom].Day < oldest {
+		keepFrom++
+	}
+	return append([]DailyStats(nil), days[keepFrom:]...)
+}
+
+func copyStats(days []DailyStats) []DailyStats {
+	var copied = make([]DailyStats, len(days))
+	for index, day := range days {
+		day.Latency = append([]int(nil), day.Latency...)
+		copied[index] = day
+	}
+	return copied
+}
+
+func (storage *store) RecordStats(id int, at time.Time, poll PollStats) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	if storage.innerStore.Feeds[id] == nil {
+		return ErrFeedNotFound
+	}
+	if storage.innerStore.FeedStats == nil {
+		storage.innerStore.FeedStats = make(map[int][]DailyStats)
+	}
+	storage.innerStore.FeedStats[id] = addToStats(storage.innerStore.FeedStats[id], at, poll)
+	storage.innerStore.TotalStats = addToStats(storage.innerStore.TotalStats, at, poll)
+	return storage.changed()
+}
+
+func (storage *store) GetStats(id int) []DailyStats {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.load()
+	return copyStats(storage.innerStore.FeedStats[id])
+}
+
+func (storage *store) GetTotalStats() []DailyStats {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.load()
+	return copyStats(storage.innerStore.TotalStats)
+}
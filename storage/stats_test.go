@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsKeepRollingDays(t *testing.T) {
+	var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	var days []DailyStats
+	for day := 0; day < StatsDays+5; day++ {
+		days = addToStats(days, start.AddDate(0, 0, day), PollStats{NewItems: 1, Latency: 300 * time.Millisecond})
+	}
+	var last = start.AddDate(0, 0, StatsDays+4)
+	days = addToStats(days, last, PollStats{Failed: true, Latency: time.Minute})
+
+	assert.Len(t, days, StatsDays)
+	assert.Equal(t, StatsDay(start.AddDate(0, 0, 5)), days[0].Day)
+	assert.Equal(t, DailyStats{Day: StatsDay(last), Polls: 2, ParseErrors: 1, NewItems: 1, LatencyMs: 60300, Latency: []int{0, 0, 1, 0, 0, 0, 0, 1}}, days[len(days)-1])
+
+	var week = StatsSince(days, last.AddDate(0, 0, -6))
+	assert.Equal(t, 8, week.Polls)
+	assert.Equal(t, 7, week.NewItems)
+}
+
+func TestStatsSeriesFillsGaps(t *testing.T) {
+	var now = time.Date(2024, 3, 10, 12, 0, 0, 0, time.Local)
+	var days = []DailyStats{{Day: StatsDay(now.AddDate(0, 0, -2)), Polls: 3}, {Day: StatsDay(now), Polls: 1}}
+
+	var series = StatsSeries(days, now, 4)
+	assert.Equal(t, []int{0, 3, 0, 1}, []int{series[0].Polls, series[1].Polls, series[2].Polls, series[3].Polls})
+	assert.Equal(t, StatsDay(now.AddDate(0, 0, -3)), series[0].Day)
+}
@@ -2,121 +2,779 @@ package storage
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/CEKlopfenstein/simple-feeds/logging"
 	"github.com/gotify/plugin-api"
 	"github.com/mmcdole/gofeed"
 )
 
-type Storage struct {
-	StorageHandler plugin.StorageHandler
-	Logger         *log.Logger
-	innerStore     innerStorageStruct
+// How long to wait for further changes before writing them to the Gotify database.
+var saveDelay = 2 * time.Second
+
+// How long to wait before trying again after writing to the Gotify database failed.
+const saveRetryDelay = 30 * time.Second
+
+// Storage holds the feeds, what has been seen from them, the client token and settings.
+// Implementations are safe for concurrent use. Everything returned is a copy, changes go through the setters.
+type Storage interface {
+	// Error returns why the stored data could not be loaded or saved. Nil when everything is fine.
+	Error() error
+	// Flush writes any pending changes right away.
+	Flush() error
+
+	GetClientToken() string
+	SaveClientToken(token string) error
+	GetSettings() Settings
+	SaveSettings(settings Settings) error
+
+	// SaveNewFeed returns the new feed even when saving failed, as it is kept in memory.
+	SaveNewFeed(url string, meta FeedMeta, backlog *BacklogPolicy) (*Feed, error)
+	GetFeedByID(id int) *Feed
+	GetFeeds() map[int]*Feed
+	RemoveFeedByID(id int) error
+	// Removes every given feed, or none of them when any does not exist.
+	RemoveFeedsByID(ids []int) error
+	// Points the feed at a new URL. Without keepHistory the items seen so far are forgotten and
+	// whatever the new URL holds is marked as seen on the next poll.
+	SaveFeedUrl(id int, url string, keepHistory bool) error
+	// Points each feed at its new URL keeping what has been seen. Either every feed is moved or none is,
+	// such as when a feed does not exist or two feeds would share a URL.
+	SaveFeedUrls(urls map[int]string) error
+	SaveFeedDisplayName(id int, name string) error
+	SaveFeedSettings(id int, settings FeedSettings) error
+	// Applies every change of the edit or, such as when its group does not exist, none of them.
+	EditFeed(id int, edit FeedEdit) error
+	// Makes the feed receive its items through a webhook.
+	SaveFeedWebhook(id int, source WebhookSource) error
+	// Replaces the targets items of the feed are delivered to. With only set they are no longer sent to Gotify.
+	SaveFeedTargets(id int, targets []Target, only bool) error
+	// Records the outcome of the latest delivery to a target of the feed.
+	RecordTargetResult(id int, targetID string, result TargetResult) error
+	// Moves the feed into the named group, which must exist. An empty name removes the feed from its group.
+	SaveFeedGroupAndTags(id int, group string, tags []string) error
+	SaveFeedPolled(id int, polled time.Time) error
+	// Records the outcome of fetching the feed. A nil error is a successful fetch.
+	SaveFeedHealth(id int, fetchError error, at time.Time) error
+	SaveFeedMeta(id int, meta FeedMeta) error
+	PauseFeed(id int, reason string) error
+	// Stops polling the feed until the given time. Items published in the meantime are not sent.
+	SnoozeFeed(id int, until time.Time) error
+	// Ends a pause or snooze. Items published in the meantime are marked as seen on the next poll.
+	ResumeFeed(id int) error
+	// Records the items seen by a poll of the feed at feedUrl. Returns ErrFeedMoved without recording anything when
+	// the feed has moved to another URL since.
+	SaveITemUrlsAndLatestDate(id int, feedUrl string, urls []string, time *time.Time) error
+
+	// Adds to the delivery log of the feed, dropping the oldest entries past the size of the log.
+	RecordDeliveries(id int, deliveries []Delivery) error
+	// The delivery log of the feed, oldest first.
+	GetDeliveries(id int) []Delivery
+	// Treats the item with the link as new on the next poll of the feed.
+	MarkItemUnseen(id int, link string) error
+
+	// Adds the poll to the statistics of the feed and the totals, dropping days past StatsDays.
+	RecordStats(id int, at time.Time, poll PollStats) error
+	// The daily statistics of the feed, oldest first. Days without polls are missing.
+	GetStats(id int) []DailyStats
+	// The daily statistics of all feeds, including deleted ones, oldest first.
+	GetTotalStats() []DailyStats
+	// Saves the ETag and Last-Modified headers of the last fetch, sent back on the next fetch to skip an unchanged feed.
+	SaveFeedValidators(id int, etag string, lastModified string) error
+
+	GetGroups() map[string]*Group
+	// Creates or updates the group of the same name.
+	SaveGroup(group Group) error
+	// Removes the group, moving its feeds out of any group.
+	RemoveGroup(name string) error
+
+	// Export returns every setting and feed, including what has been seen, as JSON that Import accepts.
+	Export() ([]byte, error)
+	// Import applies an export. Replacing discards the current feeds and settings. Merging matches feeds by URL, combining
+	// what has been seen and taking the imported settings of the feed, while keeping the current token and global settings if set.
+	// Nothing is changed if the export is invalid.
+	Import(data []byte, replace bool) (ImportSummary, error)
+}
+
+// GotifyStorage keeps the data in memory and writes changes back to the Gotify database shortly after they are made.
+type GotifyStorage struct {
+	store
+}
+
+func NewGotifyStorage(handler plugin.StorageHandler, logger *slog.Logger) *GotifyStorage {
+	return &GotifyStorage{store: store{handler: handler, logger: logger}}
+}
+
+// MemoryStorage only keeps the data in memory. Meant for tests.
+type MemoryStorage struct {
+	store
+}
+
+func NewMemoryStorage(logger *slog.Logger) *MemoryStorage {
+	return &MemoryStorage{store: store{logger: logger}}
+}
+
+// Implements Storage for both GotifyStorage and MemoryStorage. Nothing is loaded or saved without a handler.
+type store struct {
+	handler    plugin.StorageHandler
+	logger     *slog.Logger
+	lock       sync.Mutex
+	loaded     bool
+	innerStore innerStorageStruct
+	// Set when the stored data could not be loaded. Saving is refused while set so the stored data is not overwritten.
+	loadError error
+	// Set while the last write to the Gotify database failed.
+	saveError error
+	dirty     bool
+	saveTimer *time.Timer
 }
 
 type innerStorageStruct struct {
-	ClientToken string
-	NextID      int
-	Feeds       map[int]*Feed
+	SchemaVersion int
+	Backup        *SchemaBackup `json:",omitempty"`
+	ClientToken   string
+	NextID        int
+	Feeds         map[int]*Feed
+	Groups        map[string]*Group
+	Settings      *Settings
+	// Latest deliveries of each feed by feed ID, oldest first.
+	Deliveries map[int][]Delivery `json:",omitempty"`
+	// Daily statistics of each feed by feed ID and of all feeds together.
+	FeedStats  map[int][]DailyStats `json:",omitempty"`
+	TotalStats []DailyStats         `json:",omitempty"`
+}
+
+// Settings are the global settings for the plugin. Zero values disable the related protection.
+type Settings struct {
+	// Maximum number of messages sent for all feeds within a minute.
+	RateLimitPerMinute int
+	// Maximum number of items sent for a single feed per poll. Can be overridden per feed.
+	MaxItemsPerPoll int
+	// Percentage of a feed's items that need to look new at once to pause the feed.
+	BreakerPercent int
+	// Minimum number of items a feed needs before the breaker is considered.
+	BreakerMinItems int
+	// Minutes between polls of a feed. Can be overridden per group or feed.
+	PollMinutes int
+	// Priority of the messages sent. Can be overridden per group or feed.
+	Priority int
+	// Token of the Gotify application messages are sent to. The plugin's own application when empty.
+	// Can be overridden per group or feed.
+	AppToken string
+}
+
+func DefaultSettings() Settings {
+	return Settings{RateLimitPerMinute: 30, MaxItemsPerPoll: 10, BreakerPercent: 80, BreakerMinItems: 10, PollMinutes: 5}
 }
 
 type Feed struct {
 	id       int
 	Url      string
+	Meta     FeedMeta
 	LastDate *time.Time
 	ItemUrls map[string]bool
+	// Shown instead of the title of the feed when set.
+	DisplayName string
+	// Backlog is the baseline to apply on the next fetch of the feed. Cleared once applied.
+	Backlog *BacklogPolicy
+	// Overrides the settings of the group and the global settings.
+	Settings   FeedSettings
+	Group      string
+	Tags       []string
+	LastPolled *time.Time
+	// A paused feed is not polled until it is resumed.
+	Paused      bool
+	PauseReason string
+	// The feed is not polled before this time.
+	SnoozedUntil *time.Time
+	// Links of items to be treated as new on the next poll even though they were seen.
+	Unseen map[string]bool `json:",omitempty"`
+	// When the feed was last fetched successfully.
+	LastSuccess *time.Time
+	// The last error fetching the feed. Kept after the feed recovers.
+	LastError   string
+	LastErrorAt *time.Time
+	// Number of fetches that failed in a row.
+	Failures int
+	// Validators of the last fetch for a conditional request.
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+	// Set on feeds whose items are pushed to a webhook. They have no URL and are never polled.
+	Webhook *WebhookSource `json:",omitempty"`
+	// New items are also delivered to each target.
+	Targets []Target `json:",omitempty"`
+	// Items are delivered to the targets only, not to Gotify. Ignored when the feed has no targets.
+	TargetsOnly bool `json:",omitempty"`
+}
+
+// Health of a feed as shown in the feed list.
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+	HealthNever   = "never"
+	HealthPaused  = "paused"
+)
+
+// Health sums up whether the feed is being fetched at the given time.
+func (feed *Feed) Health(now time.Time) string {
+	switch {
+	case feed.Paused || feed.IsSnoozed(now):
+		return HealthPaused
+	case feed.Failures > 0:
+		return HealthFailing
+	case feed.LastSuccess == nil:
+		return HealthNever
+	}
+	return HealthOK
+}
+
+// FeedMeta is what the feed said about itself the last time it was fetched.
+type FeedMeta struct {
+	Title       string
+	Description string
+	SiteLink    string
+	Icon        string
+	ItemCount   int
+	UpdatedAt   time.Time
+}
+
+const (
+	BacklogNone   = "none"
+	BacklogLatest = "latest"
+	BacklogSince  = "since"
+	BacklogAll    = "all"
+)
+
+// BacklogPolicy decides which of the items already present in a feed are sent when subscribing to it.
+type BacklogPolicy struct {
+	Mode  string
+	Count int
+	Since *time.Time
 }
 
 func (feed *Feed) GetID() int {
 	return feed.id
 }
 
-// Saves the current inner storage struct. Should be called after every save/set
-func (storage *Storage) save() {
-	storageBytes, _ := json.Marshal(storage.innerStore)
-	storage.StorageHandler.Save(storageBytes)
+// Name is the display name of the feed, falling back to its title then its URL.
+func (feed *Feed) Name() string {
+	if len(feed.DisplayName) != 0 {
+		return feed.DisplayName
+	}
+	if len(feed.Meta.Title) != 0 {
+		return feed.Meta.Title
+	}
+	return feed.Url
+}
+
+// Whether the feed is snoozed at the given time.
+func (feed *Feed) IsSnoozed(now time.Time) bool {
+	return feed.SnoozedUntil != nil && now.Before(*feed.SnoozedUntil)
 }
 
-// Loads the stored values from the DB into the current inner storage struct. Should be called before every get.
-func (storage *Storage) load() {
-	storageBytes, err := storage.StorageHandler.Load()
+func (feed *Feed) copy() *Feed {
+	var feedCopy = *feed
+	feedCopy.ItemUrls = make(map[string]bool, len(feed.ItemUrls))
+	for url, seen := range feed.ItemUrls {
+		feedCopy.ItemUrls[url] = seen
+	}
+	feedCopy.LastDate = copyPointer(feed.LastDate)
+	feedCopy.Backlog = copyPointer(feed.Backlog)
+	feedCopy.Settings = feed.Settings.copy()
+	feedCopy.Tags = append([]string(nil), feed.Tags...)
+	feedCopy.LastPolled = copyPointer(feed.LastPolled)
+	feedCopy.SnoozedUntil = copyPointer(feed.SnoozedUntil)
+	feedCopy.LastSuccess = copyPointer(feed.LastSuccess)
+	feedCopy.LastErrorAt = copyPointer(feed.LastErrorAt)
+	feedCopy.Webhook = copyPointer(feed.Webhook)
+	feedCopy.Targets = copyTargets(feed.Targets)
+	if feed.Unseen != nil {
+		feedCopy.Unseen = make(map[string]bool, len(feed.Unseen))
+		for url, unseen := range feed.Unseen {
+			feedCopy.Unseen[url] = unseen
+		}
+	}
+	return &feedCopy
+}
+
+func copyPointer[T any](pointer *T) *T {
+	if pointer == nil {
+		return nil
+	}
+	var value = *pointer
+	return &value
+}
+
+var ErrFeedNotFound = errors.New("feed not found")
+var ErrFeedMoved = errors.New("feed moved to another URL")
+
+// Returned by setters while the stored data could not be loaded. Nothing is changed.
+type LoadError struct {
+	Err error
+}
+
+func (err LoadError) Error() string {
+	return "stored data could not be loaded so changes are not allowed: " + err.Err.Error()
+}
+
+func (err LoadError) Unwrap() error {
+	return err.Err
+}
+
+// Returned when writing to the Gotify database failed. The changes are kept in memory and the write is retried.
+type SaveError struct {
+	Err error
+}
+
+func (err SaveError) Error() string {
+	return "failed to save to the database, changes are kept until the next attempt: " + err.Err.Error()
+}
+
+func (err SaveError) Unwrap() error {
+	return err.Err
+}
+
+// Writes the inner storage struct to the Gotify database. Must hold the lock.
+func (storage *store) save() error {
+	if storage.handler == nil {
+		storage.dirty = false
+		return nil
+	}
+	if storage.loadError != nil {
+		return LoadError{Err: storage.loadError}
+	}
+	storage.innerStore.SchemaVersion = SchemaVersion
+	storageBytes, err := json.Marshal(storage.innerStore)
+	if err == nil {
+		err = storage.handler.Save(storageBytes)
+	}
 	if err != nil {
-		storage.Logger.Println(err)
+		storage.saveError = SaveError{Err: err}
+		storage.logger.Error("Failed to save", "error", storage.saveError)
+		storage.scheduleSave(saveRetryDelay)
+		return storage.saveError
+	}
+	storage.saveError = nil
+	storage.dirty = false
+	return nil
+}
+
+// Must hold the lock.
+func (storage *store) scheduleSave(delay time.Duration) {
+	if storage.saveTimer != nil {
+		storage.saveTimer.Stop()
+	}
+	storage.saveTimer = time.AfterFunc(delay, func() {
+		storage.lock.Lock()
+		defer storage.lock.Unlock()
+		if storage.dirty {
+			storage.save()
+		}
+	})
+}
+
+// Marks the inner storage struct as changed and schedules a save. Should be called after every set. Must hold the lock.
+// Returns the error of the last save if it failed, as the new changes will only be kept in memory until saving works again.
+func (storage *store) changed() error {
+	storage.dirty = true
+	if storage.handler != nil && storage.saveError == nil {
+		storage.scheduleSave(saveDelay)
+	}
+	return storage.saveError
+}
+
+// Must hold the lock.
+func (storage *store) writable() error {
+	storage.load()
+	if storage.loadError != nil {
+		return LoadError{Err: storage.loadError}
+	}
+	return nil
+}
+
+func (storage *store) Flush() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if storage.saveTimer != nil {
+		storage.saveTimer.Stop()
+		storage.saveTimer = nil
+	}
+	if storage.dirty {
+		return storage.save()
+	}
+	return nil
+}
+
+// Loads the stored values from the DB into the inner storage struct the first time it is needed. Must hold the lock.
+func (storage *store) load() {
+	if storage.loaded {
+		return
+	}
+	if storage.handler == nil {
+		storage.loaded = true
+		storage.innerStore.SchemaVersion = SchemaVersion
+		storage.innerStore.normalize()
+		return
+	}
+
+	storageBytes, err := storage.handler.Load()
+	storage.loadError = err
+	if err != nil {
+		storage.logger.Error("Failed to load stored data", "error", err)
 		return
 	}
 
 	if len(storageBytes) == 0 {
-		storageBytes, _ = json.Marshal(storage.innerStore)
-		storage.StorageHandler.Save(storageBytes)
+		storage.innerStore.SchemaVersion = SchemaVersion
 	} else {
-		json.Unmarshal(storageBytes, &storage.innerStore)
+		var migrated bool
+		storageBytes, migrated, err = migrate(storageBytes)
+		if err == nil {
+			var innerStore innerStorageStruct
+			err = json.Unmarshal(storageBytes, &innerStore)
+			storage.innerStore = innerStore
+		}
+		if err != nil {
+			storage.loadError = err
+			storage.loaded = true
+			storage.logger.Error("Failed to load stored data", "error", err)
+			return
+		}
+		if migrated {
+			storage.logger.Info("Migrated stored data", "schema", SchemaVersion)
+			storage.dirty = true
+			storage.save()
+		}
 	}
+	storage.loaded = true
+	storage.innerStore.normalize()
 }
 
-func (storage *Storage) GetClientToken() string {
+// Fills in what is not stored or may be missing from the stored data.
+func (innerStore *innerStorageStruct) normalize() {
+	if innerStore.Feeds == nil {
+		innerStore.Feeds = make(map[int]*Feed)
+	}
+	if innerStore.Groups == nil {
+		innerStore.Groups = make(map[string]*Group)
+	}
+	for id, feed := range innerStore.Feeds {
+		feed.id = id
+		if feed.ItemUrls == nil {
+			feed.ItemUrls = make(map[string]bool)
+		}
+	}
+}
+
+func (storage *store) Error() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
 	storage.load()
-	return storage.innerStore.ClientToken
+	if storage.loadError != nil {
+		return LoadError{Err: storage.loadError}
+	}
+	return storage.saveError
 }
 
-func (storage *Storage) SaveClientToken(token string) {
+func (storage *store) GetClientToken() string {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
 	storage.load()
+	return storage.innerStore.ClientToken
+}
+
+func (storage *store) SaveClientToken(token string) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
 	storage.innerStore.ClientToken = token
-	storage.save()
+	return storage.changed()
+}
+
+func (storage *store) GetSettings() Settings {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	storage.load()
+	if storage.innerStore.Settings == nil {
+		return DefaultSettings()
+	}
+	return *storage.innerStore.Settings
 }
 
-func (storage *Storage) GetNextFeedID() int {
-	var id = 0
-	var item *Feed = storage.innerStore.Feeds[id]
-	for item != nil {
-		id++
-		item = storage.innerStore.Feeds[id]
+func (storage *store) SaveSettings(settings Settings) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
 	}
+	storage.innerStore.Settings = &settings
+	return storage.changed()
+}
+
+// Must hold the lock. IDs of removed feeds are not given out again, so that what is recorded by ID for a removed feed
+// never lands on another one.
+func (storage *store) nextFeedID() int {
+	var id = storage.innerStore.NextID
+	for existing := range storage.innerStore.Feeds {
+		id = max(id, existing+1)
+	}
+	storage.innerStore.NextID = id + 1
 	return id
 }
 
-func (storage *Storage) SaveNewFeed(url string) *Feed {
-	storage.load()
-	var newID = storage.GetNextFeedID()
-	if storage.innerStore.Feeds == nil {
-		storage.innerStore.Feeds = make(map[int]*Feed)
-		storage.save()
+func (storage *store) SaveNewFeed(url string, meta FeedMeta, backlog *BacklogPolicy) (*Feed, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return nil, err
 	}
-	storage.innerStore.Feeds[newID] = &Feed{Url: url, id: newID, ItemUrls: make(map[string]bool)}
-	storage.Logger.Printf("Saved New Feed: %s", url)
-	storage.save()
-	return storage.innerStore.Feeds[newID]
+	var newID = storage.nextFeedID()
+	storage.innerStore.Feeds[newID] = &Feed{Url: url, Meta: meta, id: newID, ItemUrls: make(map[string]bool), Backlog: backlog}
+	storage.logger.Info("Saved New Feed", logging.Feed(newID), "url", url)
+	var err = storage.changed()
+	return storage.innerStore.Feeds[newID].copy(), err
 }
 
-func (storage *Storage) GetFeedByID(id int) *Feed {
+func (storage *store) GetFeedByID(id int) *Feed {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
 	storage.load()
-	if storage.innerStore.Feeds == nil {
+	var feed = storage.innerStore.Feeds[id]
+	if feed == nil {
 		return nil
 	}
-
-	return storage.innerStore.Feeds[id]
+	return feed.copy()
 }
 
-func (storage *Storage) RemoveFeedByID(id int) {
-	storage.load()
-	if storage.innerStore.Feeds == nil || storage.innerStore.Feeds[id] == nil {
-		return
+func (storage *store) RemoveFeedByID(id int) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
 	}
-	storage.Logger.Printf("Deleted Feed: %s", storage.innerStore.Feeds[id].Url)
+	if storage.innerStore.Feeds[id] == nil {
+		return ErrFeedNotFound
+	}
+	storage.logger.Info("Deleted Feed", logging.Feed(id), "url", storage.innerStore.Feeds[id].Url)
 	delete(storage.innerStore.Feeds, id)
-	storage.save()
+	delete(storage.innerStore.Deliveries, id)
+	delete(storage.innerStore.FeedStats, id)
+	return storage.changed()
+}
+
+func sortedIDs(feeds map[int]*Feed) []int {
+	var ids = []int{}
+	for id := range feeds {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Applies update to the stored feed.
+func (storage *store) updateFeed(id int, update func(feed *Feed)) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	var feed = storage.innerStore.Feeds[id]
+	if feed == nil {
+		return ErrFeedNotFound
+	}
+	update(feed)
+	return storage.changed()
+}
+
+func (storage *store) SaveFeedUrl(id int, url string, keepHistory bool) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		storage.moveFeed(feed, url, keepHistory)
+	})
+}
+
+// Must hold the lock.
+func (storage *store) moveFeed(feed *Feed, url string, keepHistory bool) {
+	storage.logger.Info("Moved Feed", logging.Feed(feed.id), "from", feed.Url, "to", url)
+	feed.Url = url
+	feed.ETag = ""
+	feed.LastModified = ""
+	if !keepHistory {
+		feed.ItemUrls = make(map[string]bool)
+		feed.LastDate = nil
+		catchUpSilently(feed)
+	}
+}
+
+// FeedEdit changes several fields of a feed at once. Nil fields are left as they are.
+type FeedEdit struct {
+	// Moves the feed, as SaveFeedUrl does with KeepHistory.
+	Url         *string
+	KeepHistory bool
+	Meta        *FeedMeta
+	DisplayName *string
+	Settings    *FeedSettings
+	// The named group must exist. An empty name removes the feed from its group.
+	Group *string
+	Tags  *[]string
+	// Replaces the mapping, signature and token of a webhook feed.
+	Webhook *WebhookSource
+}
+
+func (storage *store) EditFeed(id int, edit FeedEdit) error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+	if err := storage.writable(); err != nil {
+		return err
+	}
+	var feed = storage.innerStore.Feeds[id]
+	if feed == nil {
+		return ErrFeedNotFound
+	}
+	if edit.Group != nil && len(*edit.Group) != 0 && storage.innerStore.Groups[*edit.Group] == nil {
+		return ErrGroupNotFound
+	}
+
+	if edit.Url != nil && *edit.Url != feed.Url {
+		storage.moveFeed(feed, *edit.Url, edit.KeepHistory)
+	}
+	if edit.Meta != nil {
+		feed.Meta = *edit.Meta
+	}
+	if edit.DisplayName != nil {
+		feed.DisplayName = *edit.DisplayName
+	}
+	if edit.Settings != nil {
+		feed.Settings = edit.Settings.copy()
+	}
+	if edit.Group != nil {
+		feed.Group = *edit.Group
+	}
+	if edit.Tags != nil {
+		feed.Tags = append([]string(nil), *edit.Tags...)
+	}
+	if edit.Webhook != nil {
+		if feed.Webhook == nil || feed.Webhook.Token != edit.Webhook.Token {
+			storage.logger.Info("Set webhook token", logging.Feed(id))
+		}
+		var source = *edit.Webhook
+		feed.Webhook = &source
+	}
+	return storage.changed()
+}
+
+func (storage *store) SaveFeedDisplayName(id int, name string) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.DisplayName = name
+	})
+}
+
+func (storage *store) SaveFeedSettings(id int, settings FeedSettings) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.Settings = settings.copy()
+	})
+}
+
+func (storage *store) SaveFeedHealth(id int, fetchError error, at time.Time) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		if fetchError == nil {
+			feed.LastSuccess = &at
+			feed.Failures = 0
+			return
+		}
+		feed.LastError = fetchError.Error()
+		feed.LastErrorAt = &at
+		feed.Failures++
+	})
+}
+
+func (storage *store) SaveFeedValidators(id int, etag string, lastModified string) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.ETag = etag
+		feed.LastModified = lastModified
+	})
+}
+
+func (storage *store) SaveFeedPolled(id int, polled time.Time) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.LastPolled = &polled
+	})
 }
 
-func (storage *Storage) GetFeeds() *map[int]*Feed {
+func (storage *store) SaveFeedMeta(id int, meta FeedMeta) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.Meta = meta
+	})
+}
+
+func (storage *store) PauseFeed(id int, reason string) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.Paused = true
+		feed.PauseReason = reason
+		storage.logger.Warn("Paused Feed", logging.Feed(id), "url", feed.Url, "reason", reason)
+	})
+}
+
+func (storage *store) SnoozeFeed(id int, until time.Time) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.SnoozedUntil = &until
+		catchUpSilently(feed)
+		storage.logger.Info("Snoozed Feed", logging.Feed(id), "url", feed.Url, "until", until.Format(time.RFC1123))
+	})
+}
+
+func (storage *store) ResumeFeed(id int) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.Paused = false
+		feed.PauseReason = ""
+		feed.SnoozedUntil = nil
+		catchUpSilently(feed)
+		storage.logger.Info("Resumed Feed", logging.Feed(id), "url", feed.Url)
+	})
+}
+
+// Marks whatever the feed holds at its next poll as seen without sending it, unless a backlog is still to be applied.
+func catchUpSilently(feed *Feed) {
+	if feed.Backlog == nil {
+		feed.Backlog = &BacklogPolicy{Mode: BacklogNone}
+	}
+}
+
+func (storage *store) GetFeeds() map[int]*Feed {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
 	storage.load()
-	if storage.innerStore.Feeds == nil {
-		storage.innerStore.Feeds = make(map[int]*Feed)
-		storage.save()
+	var feeds = make(map[int]*Feed, len(storage.innerStore.Feeds))
+	for id, feed := range storage.innerStore.Feeds {
+		feeds[id] = feed.copy()
 	}
-	return &storage.innerStore.Feeds
+	return feeds
 }
 
-func (feed *Feed) IsItemNew(item *gofeed.Item, storage *Storage) bool {
+// SeenKey is what an item is remembered by once seen. Items pushed to a webhook may share a link or have none,
+// so they are remembered by their ID.
+func (feed *Feed) SeenKey(itemID string, link string) string {
+	if feed.Webhook != nil && len(itemID) != 0 {
+		return itemID
+	}
+	return link
+}
+
+func (feed *Feed) IsItemNew(item *gofeed.Item) bool {
+	var key = feed.SeenKey(item.GUID, item.Link)
+	if feed.Unseen[key] {
+		return true
+	}
+	// Pushed items are new until seen whatever their date, as they may arrive out of order.
+	if feed.Webhook != nil {
+		return !feed.ItemUrls[key]
+	}
+
 	var timeOfPost = item.UpdatedParsed
 	if timeOfPost == nil {
 		timeOfPost = item.PublishedParsed
@@ -128,18 +786,25 @@ func (feed *Feed) IsItemNew(item *gofeed.Item, storage *Storage) bool {
 
 	_, isPresent := feed.ItemUrls[item.Link]
 
-	if timeOfPost == nil && !isPresent {
-		println("New By Link", isPresent, item.Link)
-	}
-
 	return timeOfPost == nil && !isPresent
 }
 
-func (storage *Storage) SaveITemUrlsAndLatestDate(id int, urls []string, time *time.Time) {
-	storage.innerStore.Feeds[id].LastDate = time
-	storage.innerStore.Feeds[id].LastDate = time
-	for _, url := range urls {
-		storage.innerStore.Feeds[id].ItemUrls[url] = true
+func (storage *store) SaveITemUrlsAndLatestDate(id int, feedUrl string, urls []string, time *time.Time) error {
+	var moved = false
+	var err = storage.updateFeed(id, func(feed *Feed) {
+		if feed.Url != feedUrl {
+			moved = true
+			return
+		}
+		feed.LastDate = time
+		feed.Backlog = nil
+		for _, url := range urls {
+			feed.ItemUrls[url] = true
+			delete(feed.Unseen, url)
+		}
+	})
+	if err == nil && moved {
+		return ErrFeedMoved
 	}
-	storage.save()
+	return err
 }
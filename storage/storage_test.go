@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testLogger = slog.New(slog.DiscardHandler)
+
+// Gotify storage handler that keeps the blob in memory and can be made to fail.
+type fakeHandler struct {
+	lock    sync.Mutex
+	data    []byte
+	loadErr error
+	saveErr error
+	saves   int
+	loads   int
+}
+
+func (handler *fakeHandler) Save(data []byte) error {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	handler.saves++
+	if handler.saveErr != nil {
+		return handler.saveErr
+	}
+	handler.data = data
+	return nil
+}
+
+func (handler *fakeHandler) Load() ([]byte, error) {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	handler.loads++
+	return handler.data, handler.loadErr
+}
+
+func (handler *fakeHandler) saveCount() int {
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	return handler.saves
+}
+
+func TestImplementations(t *testing.T) {
+	assert.Implements(t, (*Storage)(nil), new(GotifyStorage))
+	assert.Implements(t, (*Storage)(nil), new(MemoryStorage))
+}
+
+func TestMemoryStorageReturnsCopies(t *testing.T) {
+	var store Storage = NewMemoryStorage(testLogger)
+
+	feed, err := store.SaveNewFeed("https://example.com/feed", FeedMeta{Title: "Example"}, nil)
+	assert.NoError(t, err)
+	feed.Url = "changed"
+	feed.ItemUrls["https://example.com/1"] = true
+
+	var stored = store.GetFeedByID(feed.GetID())
+	assert.Equal(t, "https://example.com/feed", stored.Url)
+	assert.Empty(t, stored.ItemUrls)
+
+	var latest = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.SaveITemUrlsAndLatestDate(feed.GetID(), "https://example.com/feed", []string{"https://example.com/1"}, &latest))
+	stored = store.GetFeeds()[feed.GetID()]
+	assert.True(t, stored.ItemUrls["https://example.com/1"])
+	assert.Equal(t, latest, *stored.LastDate)
+
+	assert.ErrorIs(t, store.PauseFeed(feed.GetID()+1, "missing"), ErrFeedNotFound)
+	assert.NoError(t, store.RemoveFeedByID(feed.GetID()))
+	assert.Nil(t, store.GetFeedByID(feed.GetID()))
+}
+
+func TestFeedIDsAreNotReused(t *testing.T) {
+	var store Storage = NewMemoryStorage(testLogger)
+	first, _ := store.SaveNewFeed("https://example.com/a", FeedMeta{}, nil)
+	second, _ := store.SaveNewFeed("https://example.com/b", FeedMeta{}, nil)
+	assert.NoError(t, store.RemoveFeedByID(second.GetID()))
+
+	third, _ := store.SaveNewFeed("https://example.com/c", FeedMeta{}, nil)
+	assert.NotEqual(t, second.GetID(), third.GetID())
+	assert.NotEqual(t, first.GetID(), third.GetID())
+	assert.ErrorIs(t, store.SaveITemUrlsAndLatestDate(second.GetID(), second.Url, []string{"https://example.com/b/1"}, nil), ErrFeedNotFound)
+}
+
+func TestSeenItemsOfAMovedFeedAreNotSaved(t *testing.T) {
+	var store Storage = NewMemoryStorage(testLogger)
+	feed, _ := store.SaveNewFeed("https://example.com/a", FeedMeta{}, &BacklogPolicy{Mode: BacklogAll})
+	assert.NoError(t, store.SaveFeedUrl(feed.GetID(), "https://example.com/b", true))
+
+	assert.ErrorIs(t, store.SaveITemUrlsAndLatestDate(feed.GetID(), "https://example.com/a", []string{"https://example.com/a/1"}, nil), ErrFeedMoved)
+	var stored = store.GetFeedByID(feed.GetID())
+	assert.Empty(t, stored.ItemUrls)
+	assert.NotNil(t, stored.Backlog)
+}
+
+func TestGotifyStorageSavesOnFlush(t *testing.T) {
+	var handler = &fakeHandler{}
+	var store = NewGotifyStorage(handler, testLogger)
+
+	assert.NoError(t, store.SaveClientToken("token"))
+	assert.Equal(t, 0, handler.saves)
+	assert.NoError(t, store.Flush())
+	assert.Equal(t, 1, handler.saves)
+
+	var reloaded = NewGotifyStorage(handler, testLogger)
+	assert.Equal(t, "token", reloaded.GetClientToken())
+}
+
+func TestGotifyStorageLoadsOnce(t *testing.T) {
+	var handler = &fakeHandler{data: fmt.Appendf(nil, `{"SchemaVersion": %d, "ClientToken": "token"}`, SchemaVersion)}
+	var store = NewGotifyStorage(handler, testLogger)
+	for range 3 {
+		assert.Equal(t, "token", store.GetClientToken())
+		store.GetFeeds()
+	}
+	assert.Equal(t, 1, handler.loads)
+}
+
+func TestGotifyStorageSavesChangesTogether(t *testing.T) {
+	defer func(delay time.Duration) { saveDelay = delay }(saveDelay)
+	saveDelay = 20 * time.Millisecond
+	var handler = &fakeHandler{}
+	var store = NewGotifyStorage(handler, testLogger)
+
+	for index := range 5 {
+		_, err := store.SaveNewFeed(fmt.Sprintf("https://example.com/%d", index), FeedMeta{}, nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 0, handler.saveCount())
+	assert.Eventually(t, func() bool { return handler.saveCount() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(2 * saveDelay)
+	assert.Equal(t, 1, handler.saveCount())
+	assert.NoError(t, store.Flush())
+	assert.Equal(t, 1, handler.saveCount())
+}
+
+func TestStorageIsSafeForConcurrentUse(t *testing.T) {
+	var store Storage = NewGotifyStorage(&fakeHandler{}, testLogger)
+	var group sync.WaitGroup
+	for worker := range 8 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for index := range 20 {
+				feed, err := store.SaveNewFeed(fmt.Sprintf("https://example.com/%d/%d", worker, index), FeedMeta{}, nil)
+				assert.NoError(t, err)
+				assert.NoError(t, store.SaveITemUrlsAndLatestDate(feed.GetID(), feed.Url, []string{feed.Url + "/1"}, nil))
+				assert.NoError(t, store.RecordStats(feed.GetID(), time.Now(), PollStats{NewItems: 1}))
+				for _, other := range store.GetFeeds() {
+					other.ItemUrls["changed"] = true
+				}
+			}
+		}()
+	}
+	group.Wait()
+
+	var feeds = store.GetFeeds()
+	assert.Len(t, feeds, 160)
+	for _, feed := range feeds {
+		assert.Len(t, feed.ItemUrls, 1)
+	}
+	assert.Equal(t, 160, StatsSince(store.GetTotalStats(), time.Now()).NewItems)
+	assert.NoError(t, store.Flush())
+}
+
+func TestGotifyStorageKeepsChangesWhenSaveFails(t *testing.T) {
+	var handler = &fakeHandler{saveErr: errors.New("database is locked")}
+	var store = NewGotifyStorage(handler, testLogger)
+
+	_, err := store.SaveNewFeed("https://example.com/feed", FeedMeta{}, nil)
+	assert.NoError(t, err)
+	assert.ErrorAs(t, store.Flush(), &SaveError{})
+	assert.ErrorAs(t, store.Error(), &SaveError{})
+	assert.Len(t, store.GetFeeds(), 1)
+
+	handler.saveErr = nil
+	assert.NoError(t, store.Flush())
+	assert.NoError(t, store.Error())
+	assert.Contains(t, string(handler.data), "https://example.com/feed")
+}
+
+func TestGotifyStorageSurfacesLoadErrors(t *testing.T) {
+	for _, handler := range []*fakeHandler{
+		{loadErr: errors.New("database is locked")},
+		{data: []byte(`{"Feeds": "not feeds"}`)},
+	} {
+		var store = NewGotifyStorage(handler, testLogger)
+		assert.ErrorAs(t, store.Error(), &LoadError{})
+		_, err := store.SaveNewFeed("https://example.com/feed", FeedMeta{}, nil)
+		assert.ErrorAs(t, err, &LoadError{})
+		assert.Empty(t, store.GetFeeds())
+		// The stored data is left alone so that it can be recovered.
+		assert.NoError(t, store.Flush())
+		assert.Equal(t, 0, handler.saves)
+	}
+}
+
+func TestGotifyStorageReportsFailedSavesOnChanges(t *testing.T) {
+	var handler = &fakeHandler{saveErr: errors.New("disk full")}
+	var store = NewGotifyStorage(handler, testLogger)
+	assert.NoError(t, store.SaveClientToken("token"))
+	assert.ErrorAs(t, store.Flush(), &SaveError{})
+
+	// Later changes are kept in memory and say that they are not saved yet.
+	assert.ErrorAs(t, store.SaveSettings(Settings{PollMinutes: 10}), &SaveError{})
+	assert.Equal(t, 10, store.GetSettings().PollMinutes)
+	handler.saveErr = nil
+	assert.NoError(t, store.Flush())
+	assert.Contains(t, string(handler.data), `"PollMinutes":10`)
+}
+
+func TestGotifyStorageRefusesChangesWhenDataIsNewer(t *testing.T) {
+	var handler = &fakeHandler{data: []byte(`{"SchemaVersion": 999}`)}
+	var store = NewGotifyStorage(handler, testLogger)
+
+	assert.ErrorAs(t, store.Error(), &LoadError{})
+	assert.ErrorAs(t, store.SaveClientToken("token"), &LoadError{})
+	assert.NoError(t, store.Flush())
+	assert.Equal(t, 0, handler.saves)
+}
+
+func TestImportMerge(t *testing.T) {
+	var source Storage = NewMemoryStorage(testLogger)
+	feed, _ := source.SaveNewFeed("https://example.com/feed", FeedMeta{Title: "Example"}, nil)
+	source.SaveITemUrlsAndLatestDate(feed.GetID(), feed.Url, []string{"https://example.com/1"}, nil)
+	source.SaveNewFeed("https://example.org/rss", FeedMeta{Title: "Other"}, nil)
+	backup, err := source.Export()
+	assert.NoError(t, err)
+
+	var target Storage = NewMemoryStorage(testLogger)
+	target.SaveNewFeed("https://example.com/feed", FeedMeta{}, nil)
+	summary, err := target.Import(backup, false)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportSummary{Added: 1, Updated: 1}, summary)
+
+	var feeds = target.GetFeeds()
+	assert.Len(t, feeds, 2)
+	assert.True(t, feeds[0].ItemUrls["https://example.com/1"])
+	assert.Equal(t, "Example", feeds[0].Meta.Title)
+
+	_, err = target.Import([]byte(`{"Feeds": {"0": {"Url": "not a url"}}}`), true)
+	assert.Error(t, err)
+	assert.Len(t, target.GetFeeds(), 2)
+}
+
+func TestImportReplaceDropsDanglingReferences(t *testing.T) {
+	var backup = []byte(`{
+		"Feeds": {"3": {"Url": "https://example.com/feed", "Group": "Missing"}},
+		"Deliveries": {"3": [{"Title": "Kept"}], "7": [{"Title": "Orphan"}]},
+		"FeedStats": {"7": [{"Day": "2024-01-01", "Polls": 1}]}
+	}`)
+	var store Storage = NewMemoryStorage(testLogger)
+	store.SaveNewFeed("https://example.org/current", FeedMeta{}, nil)
+
+	summary, err := store.Import(backup, true)
+	assert.NoError(t, err)
+	assert.Equal(t, ImportSummary{Added: 1, Removed: 1}, summary)
+	assert.Empty(t, store.GetFeedByID(3).Group)
+	assert.Len(t, store.GetDeliveries(3), 1)
+	assert.Empty(t, store.GetDeliveries(7))
+	assert.Empty(t, store.GetStats(7))
+
+	// The next feed takes neither an imported ID nor one given out before the import.
+	feed, _ := store.SaveNewFeed("https://example.org/next", FeedMeta{}, nil)
+	assert.Greater(t, feed.GetID(), 3)
+}
+
+func TestImportMergeKeepsKnownGroups(t *testing.T) {
+	var store Storage = NewMemoryStorage(testLogger)
+	assert.NoError(t, store.SaveGroup(Group{Name: "News"}))
+	var backup = []byte(`{"Feeds": {
+		"0": {"Url": "https://example.com/a", "Group": "News"},
+		"1": {"Url": "https://example.com/b", "Group": "Missing"}
+	}}`)
+	_, err := store.Import(backup, false)
+	assert.NoError(t, err)
+
+	var groups = map[string]string{}
+	for _, feed := range store.GetFeeds() {
+		groups[feed.Url] = feed.Group
+	}
+	assert.Equal(t, map[string]string{"https://example.com/a": "News", "https://example.com/b": ""}, groups)
+}
+
+func TestEditFeedIsAllOrNothing(t *testing.T) {
+	var store Storage = NewMemoryStorage(testLogger)
+	assert.NoError(t, store.SaveGroup(Group{Name: "News"}))
+	feed, _ := store.SaveNewFeed("https://example.com/a", FeedMeta{}, nil)
+	var id = feed.GetID()
+	var name, group, missing = "Renamed", "News", "Missing"
+	var priority = 7
+
+	assert.ErrorIs(t, store.EditFeed(id, FeedEdit{DisplayName: &name, Group: &missing}), ErrGroupNotFound)
+	assert.Empty(t, store.GetFeedByID(id).DisplayName)
+
+	var url = "https://example.com/b"
+	var tags = []string{"daily"}
+	assert.NoError(t, store.EditFeed(id, FeedEdit{Url: &url, DisplayName: &name, Group: &group, Tags: &tags, Settings: &FeedSettings{Priority: &priority}}))
+	var edited = store.GetFeedByID(id)
+	assert.Equal(t, "https://example.com/b", edited.Url)
+	assert.Equal(t, "Renamed", edited.DisplayName)
+	assert.Equal(t, "News", edited.Group)
+	assert.Equal(t, []string{"daily"}, edited.Tags)
+	assert.Equal(t, 7, *edited.Settings.Priority)
+	// Moving without keeping the history marks what the new URL holds as seen.
+	assert.NotNil(t, edited.Backlog)
+
+	var hook, _ = store.SaveNewFeed("", FeedMeta{Title: "Doorbell"}, nil)
+	assert.NoError(t, store.SaveFeedWebhook(hook.GetID(), WebhookSource{Token: "old"}))
+	assert.ErrorIs(t, store.EditFeed(hook.GetID(), FeedEdit{DisplayName: &name, Webhook: &WebhookSource{Token: "new"}, Group: &missing}), ErrGroupNotFound)
+	assert.Equal(t, "old", store.GetFeedByID(hook.GetID()).Webhook.Token)
+	assert.NoError(t, store.EditFeed(hook.GetID(), FeedEdit{DisplayName: &name, Webhook: &WebhookSource{Token: "new"}}))
+	assert.Equal(t, "new", store.GetFeedByID(hook.GetID()).Webhook.Token)
+	assert.Equal(t, "Renamed", store.GetFeedByID(hook.GetID()).DisplayName)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+)
+
+var ErrTargetNotFound = errors.New("target not found")
+
+// Target forwards the new items of a feed to an HTTP endpoint besides, or instead of, Gotify.
+type Target struct {
+	// Identifies the target within its feed.
+	ID   string
+	Name string `json:",omitempty"`
+	URL  string
+	// POST when empty.
+	Method  string            `json:",omitempty"`
+	Headers map[string]string `json:",omitempty"`
+	// Template of the JSON body rendered over the item. The item as JSON when empty.
+	Body string `json:",omitempty"`
+	// Outcome of the latest delivery to the target.
+	Last *TargetResult `json:",omitempty"`
+}
+
+// TargetResult is the outcome of delivering an item to a target.
+type TargetResult struct {
+	At time.Time
+	// Title of the item delivered.
+	Title    string
+	Attempts int
+	// Status of the last response. Zero when no response was received.
+	StatusCode int    `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+// The name of the target, falling back to the host it is sent to.
+func (target Target) Label() string {
+	if len(target.Name) != 0 {
+		return target.Name
+	}
+	if parsed, err := url.Parse(target.URL); err == nil && len(parsed.Host) != 0 {
+		return parsed.Host
+	}
+	return target.URL
+}
+
+func (target Target) copy() Target {
+	var targetCopy = target
+	targetCopy.Last = copyPointer(target.Last)
+	if target.Headers != nil {
+		targetCopy.Headers = make(map[string]string, len(target.Headers))
+		for name, value := range target.Headers {
+			targetCopy.Headers[name] = value
+		}
+	}
+	return targetCopy
+}
+
+func copyTargets(targets []Target) []Target {
+	if targets == nil {
+		return nil
+	}
+	var targetsCopy = make([]Target, len(targets))
+	for index, target := range targets {
+		targetsCopy[index] = target.copy()
+	}
+	return targetsCopy
+}
+
+// The target of the feed with the given ID.
+func (feed *Feed) Target(targetID string) (Target, bool) {
+	for _, target := range feed.Targets {
+		if target.ID == targetID {
+			return target, true
+		}
+	}
+	return Target{}, false
+}
+
+// Whether items are sent to Gotify. Items are only left to the targets of the feed when it has any.
+func (feed *Feed) SendsToGotify() bool {
+	return !feed.TargetsOnly || len(feed.Targets) == 0
+}
+
+func (storage *store) SaveFeedTargets(id int, targets []Target, only bool) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		feed.Targets = copyTargets(targets)
+		feed.TargetsOnly = only
+		storage.logger.Info("Saved targets", logging.Feed(id), "targets", len(targets), "only", only)
+	})
+}
+
+func (storage *store) RecordTargetResult(id int, targetID string, result TargetResult) error {
+	var found = false
+	var err = storage.updateFeed(id, func(feed *Feed) {
+		for index := range feed.Targets {
+			if feed.Targets[index].ID == targetID {
+				feed.Targets[index].Last = &result
+				found = true
+			}
+		}
+	})
+	if err == nil && !found {
+		return ErrTargetNotFound
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveFeedTargets(t *testing.T) {
+	var store Storage = NewMemoryStorage(testLogger)
+	feed, err := store.SaveNewFeed("https://example.com/feed", FeedMeta{Title: "Example"}, nil)
+	require.NoError(t, err)
+	var id = feed.GetID()
+	assert.True(t, feed.SendsToGotify())
+
+	var targets = []Target{{ID: "a", URL: "https://chat.example.com/hook", Headers: map[string]string{"Authorization": "Bearer x"}}}
+	require.NoError(t, store.SaveFeedTargets(id, targets, true))
+	targets[0].Headers["Authorization"] = "changed"
+
+	var stored = store.GetFeedByID(id)
+	assert.False(t, stored.SendsToGotify())
+	assert.Equal(t, "Bearer x", stored.Targets[0].Headers["Authorization"])
+	assert.Equal(t, "chat.example.com", stored.Targets[0].Label())
+	stored.Targets[0].Headers["Authorization"] = "changed"
+	assert.Equal(t, "Bearer x", store.GetFeedByID(id).Targets[0].Headers["Authorization"])
+
+	var result = TargetResult{At: time.Now(), Title: "Item", Attempts: 2, StatusCode: 200}
+	require.NoError(t, store.RecordTargetResult(id, "a", result))
+	target, ok := store.GetFeedByID(id).Target("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, target.Last.Attempts)
+	assert.ErrorIs(t, store.RecordTargetResult(id, "b", result), ErrTargetNotFound)
+
+	// Without targets the items are sent to Gotify whatever the feed says.
+	require.NoError(t, store.SaveFeedTargets(id, nil, true))
+	assert.True(t, store.GetFeedByID(id).SendsToGotify())
+}
@@ -0,0 +1,53 @@
+package storage
+
+import "github.com/CEKlopfenstein/simple-feeds/logging"
+
+// Header holding the signature of webhook requests unless the source names another.
+const DefaultSignatureHeader = "X-Hub-Signature-256"
+
+// WebhookSource pushes items to a feed through its webhook instead of the feed being polled.
+type WebhookSource struct {
+	// Part of the path of the webhook. Requests without it are rejected.
+	Token string
+	// Key of the HMAC-SHA256 signature of the request body. The signature is not checked when empty.
+	Secret string `json:",omitempty"`
+	// Header holding the signature as hex, optionally prefixed with "sha256=". DefaultSignatureHeader when empty.
+	SignatureHeader string `json:",omitempty"`
+	Mapping         WebhookMapping
+}
+
+// WebhookMapping names the fields of a JSON payload items are made of. Each is a path of keys and
+// array indexes separated by dots, such as "commits.0.message". Blank paths are left out of the item.
+type WebhookMapping struct {
+	// Path of an array of items. The whole payload is a single item when blank.
+	Items       string `json:",omitempty"`
+	Title       string `json:",omitempty"`
+	Description string `json:",omitempty"`
+	Link        string `json:",omitempty"`
+	// Items without an ID are identified by their content, so the same payload sent twice is delivered once.
+	ID string `json:",omitempty"`
+	// An RFC 3339 time or unix seconds.
+	Published string `json:",omitempty"`
+	Author    string `json:",omitempty"`
+}
+
+func DefaultWebhookMapping() WebhookMapping {
+	return WebhookMapping{Title: "title", Description: "message", Link: "url"}
+}
+
+// The header the signature of the source is read from.
+func (source WebhookSource) Header() string {
+	if len(source.SignatureHeader) == 0 {
+		return DefaultSignatureHeader
+	}
+	return source.SignatureHeader
+}
+
+func (storage *store) SaveFeedWebhook(id int, source WebhookSource) error {
+	return storage.updateFeed(id, func(feed *Feed) {
+		if feed.Webhook == nil || feed.Webhook.Token != source.Token {
+			storage.logger.Info("Set webhook token", logging.Feed(id))
+		}
+		feed.Webhook = &source
+	})
+}
@@ -0,0 +1,492 @@
+package user_interface
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/CEKlopfenstein/simple-feeds/rssreader"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Path of the JSON API below the base path of the plugin.
+const apiPath = "/api/v1"
+
+// Errors of the JSON API, in the same shape as the errors of the Gotify API.
+type apiError struct {
+	Error            string `json:"error"`
+	ErrorCode        int    `json:"errorCode"`
+	ErrorDescription string `json:"errorDescription"`
+}
+
+func abortWithAPIError(ctx *gin.Context, status int, err error) {
+	ctx.AbortWithStatusJSON(status, apiError{Error: http.StatusText(status), ErrorCode: status, ErrorDescription: err.Error()})
+}
+
+type apiFeedSettings struct {
+	PollMinutes *int `json:"pollMinutes"`
+	Priority    *int `json:"priority"`
+	// Only read from requests, so that the token is never shown. Left out or null, the current token is kept.
+	AppToken *string `json:"appToken,omitempty"`
+	// Only written in answers.
+	AppTokenSet     bool `json:"appTokenSet"`
+	MaxItemsPerPoll *int `json:"maxItemsPerPoll"`
+}
+
+// Converts the settings of a request. The app token of current is kept when the request leaves it out.
+func (settings apiFeedSettings) toStorage(current storage.FeedSettings) (storage.FeedSettings, error) {
+	if settings.PollMinutes != nil && *settings.PollMinutes < 1 {
+		return storage.FeedSettings{}, errors.New("pollMinutes must be at least 1")
+	}
+	if settings.MaxItemsPerPoll != nil && *settings.MaxItemsPerPoll < 0 {
+		return storage.FeedSettings{}, errors.New("maxItemsPerPoll must not be negative")
+	}
+	var converted = storage.FeedSettings{PollMinutes: settings.PollMinutes, Priority: settings.Priority, MaxItemsPerPoll: settings.MaxItemsPerPoll}
+	if settings.AppToken == nil {
+		converted.AppToken = current.AppToken
+	} else if len(strings.TrimSpace(*settings.AppToken)) != 0 {
+		var token = strings.TrimSpace(*settings.AppToken)
+		converted.AppToken = &token
+	}
+	return converted, nil
+}
+
+type apiHealth struct {
+	Status      string     `json:"status"`
+	LastPolled  *time.Time `json:"lastPolled"`
+	LastSuccess *time.Time `json:"lastSuccess"`
+	LastError   string     `json:"lastError"`
+	LastErrorAt *time.Time `json:"lastErrorAt"`
+	// Number of fetches that failed in a row.
+	Failures int `json:"failures"`
+}
+
+type apiFeed struct {
+	ID           int             `json:"id"`
+	Url          string          `json:"url"`
+	Name         string          `json:"name"`
+	DisplayName  string          `json:"displayName"`
+	Title        string          `json:"title"`
+	Description  string          `json:"description"`
+	SiteLink     string          `json:"siteLink"`
+	Group        string          `json:"group"`
+	Tags         []string        `json:"tags"`
+	Settings     apiFeedSettings `json:"settings"`
+	Paused       bool            `json:"paused"`
+	PauseReason  string          `json:"pauseReason"`
+	SnoozedUntil *time.Time      `json:"snoozedUntil"`
+	Health       apiHealth       `json:"health"`
+	// Whether the items of the feed are pushed to a webhook. Such feeds have no URL.
+	Webhook bool `json:"webhook"`
+}
+
+func apiHealthOf(feed *storage.Feed, now time.Time) apiHealth {
+	return apiHealth{
+		Status:      feed.Health(now),
+		LastPolled:  feed.LastPolled,
+		LastSuccess: feed.LastSuccess,
+		LastError:   feed.LastError,
+		LastErrorAt: feed.LastErrorAt,
+		Failures:    feed.Failures,
+	}
+}
+
+func apiFeedOf(id int, feed *storage.Feed, now time.Time) apiFeed {
+	var converted = apiFeed{
+		ID:          id,
+		Url:         feed.Url,
+		Name:        feed.Name(),
+		DisplayName: feed.DisplayName,
+		Title:       feed.Meta.Title,
+		Description: feed.Meta.Description,
+		SiteLink:    feed.Meta.SiteLink,
+		Group:       feed.Group,
+		Tags:        feed.Tags,
+		Settings: apiFeedSettings{
+			PollMinutes:     feed.Settings.PollMinutes,
+			Priority:        feed.Settings.Priority,
+			AppTokenSet:     feed.Settings.AppToken != nil,
+			MaxItemsPerPoll: feed.Settings.MaxItemsPerPoll,
+		},
+		Paused:       feed.Paused,
+		PauseReason:  feed.PauseReason,
+		SnoozedUntil: feed.SnoozedUntil,
+		Health:       apiHealthOf(feed, now),
+		Webhook:      feed.Webhook != nil,
+	}
+	if converted.Tags == nil {
+		converted.Tags = []string{}
+	}
+	return converted
+}
+
+type apiBacklog struct {
+	// "none", "all", "latest" or "since".
+	Mode  string `json:"mode"`
+	Count int    `json:"count"`
+	// A date such as 2024-03-01, for the since mode.
+	Since string `json:"since"`
+}
+
+func (backlog *apiBacklog) toStorage() (storage.BacklogPolicy, error) {
+	if backlog == nil {
+		return storage.BacklogPolicy{Mode: storage.BacklogNone}, nil
+	}
+	var policy = storage.BacklogPolicy{Mode: backlog.Mode}
+	switch backlog.Mode {
+	case storage.BacklogNone, storage.BacklogAll:
+	case storage.BacklogLatest:
+		if backlog.Count < 1 {
+			return policy, errors.New("count must be at least 1 for the latest backlog")
+		}
+		policy.Count = backlog.Count
+	case storage.BacklogSince:
+		since, err := time.ParseInLocation("2006-01-02", backlog.Since, time.Local)
+		if err != nil {
+			return policy, fmt.Errorf("invalid date: %q", backlog.Since)
+		}
+		policy.Since = &since
+	default:
+		return policy, fmt.Errorf("unknown backlog mode: %q", backlog.Mode)
+	}
+	return policy, nil
+}
+
+type apiNewFeed struct {
+	Url         string          `json:"url"`
+	DisplayName string          `json:"displayName"`
+	Group       string          `json:"group"`
+	Tags        []string        `json:"tags"`
+	Backlog     *apiBacklog     `json:"backlog"`
+	Settings    apiFeedSettings `json:"settings"`
+}
+
+// Fields left out of a patch are left as they are.
+type apiFeedPatch struct {
+	Url         *string          `json:"url"`
+	DisplayName *string          `json:"displayName"`
+	Group       *string          `json:"group"`
+	Tags        *[]string        `json:"tags"`
+	Settings    *apiFeedSettings `json:"settings"`
+}
+
+type apiPollSummary struct {
+	Feeds       int      `json:"feeds"`
+	Found       int      `json:"found"`
+	New         int      `json:"new"`
+	Filtered    int      `json:"filtered"`
+	Deferred    int      `json:"deferred"`
+	Delivered   int      `json:"delivered"`
+	Forwarded   int      `json:"forwarded"`
+	Failed      int      `json:"failed"`
+	Queued      int      `json:"queued"`
+	Skipped     int      `json:"skipped"`
+	NotModified int      `json:"notModified"`
+	Errors      []string `json:"errors"`
+}
+
+func apiPollSummaryOf(summary rssreader.PollSummary) apiPollSummary {
+	return apiPollSummary{
+		Feeds:       summary.Feeds,
+		Found:       summary.Found,
+		New:         summary.New,
+		Filtered:    summary.Filtered,
+		Deferred:    summary.Deferred,
+		Delivered:   summary.Delivered,
+		Forwarded:   summary.Forwarded,
+		Failed:      summary.Failed,
+		Queued:      summary.Queued,
+		Skipped:     summary.Skipped,
+		NotModified: summary.NotModified,
+		Errors:      summary.Errors,
+	}
+}
+
+// Fields left out of a request are left as they are.
+type apiSettings struct {
+	RateLimitPerMinute *int `json:"rateLimitPerMinute"`
+	MaxItemsPerPoll    *int `json:"maxItemsPerPoll"`
+	BreakerPercent     *int `json:"breakerPercent"`
+	BreakerMinItems    *int `json:"breakerMinItems"`
+	PollMinutes        *int `json:"pollMinutes"`
+	Priority           *int `json:"priority"`
+	// Only read from requests, so that the token is never shown.
+	AppToken *string `json:"appToken,omitempty"`
+	// Only written in answers.
+	AppTokenSet bool `json:"appTokenSet"`
+}
+
+func apiSettingsOf(settings storage.Settings) apiSettings {
+	return apiSettings{
+		RateLimitPerMinute: &settings.RateLimitPerMinute,
+		MaxItemsPerPoll:    &settings.MaxItemsPerPoll,
+		BreakerPercent:     &settings.BreakerPercent,
+		BreakerMinItems:    &settings.BreakerMinItems,
+		PollMinutes:        &settings.PollMinutes,
+		Priority:           &settings.Priority,
+		AppTokenSet:        len(settings.AppToken) != 0,
+	}
+}
+
+func setIfPresent(target *int, value *int) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// Sets the fields of the request on settings.
+func (request apiSettings) applyTo(settings *storage.Settings) error {
+	for _, field := range []*int{request.RateLimitPerMinute, request.MaxItemsPerPoll, request.BreakerPercent, request.BreakerMinItems, request.Priority} {
+		if field != nil && *field < 0 {
+			return errors.New("settings must not be negative")
+		}
+	}
+	if request.PollMinutes != nil && *request.PollMinutes < 1 {
+		return errors.New("pollMinutes must be at least 1")
+	}
+	setIfPresent(&settings.RateLimitPerMinute, request.RateLimitPerMinute)
+	setIfPresent(&settings.MaxItemsPerPoll, request.MaxItemsPerPoll)
+	setIfPresent(&settings.BreakerPercent, request.BreakerPercent)
+	setIfPresent(&settings.BreakerMinItems, request.BreakerMinItems)
+	setIfPresent(&settings.PollMinutes, request.PollMinutes)
+	setIfPresent(&settings.Priority, request.Priority)
+	if request.AppToken != nil {
+		settings.AppToken = strings.TrimSpace(*request.AppToken)
+	}
+	return nil
+}
+
+type apiToken struct {
+	// Whether the plugin has a client token.
+	Set bool `json:"set"`
+}
+
+type apiLogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Feed    *int              `json:"feed"`
+	Attrs   map[string]string `json:"attrs"`
+}
+
+// Registers the JSON API. Expects the requests to be authenticated already.
+func buildAPI(api *gin.RouterGroup, rss *rssreader.RSS_Reader, logger *slog.Logger, logRing *logging.Ring, updateDefaultToken func(headerToken string, token string) error) {
+	api.GET("/openapi.json", func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "application/json", openAPIDocument)
+	})
+
+	api.GET("/feeds", func(ctx *gin.Context) {
+		var now = time.Now()
+		var feeds = rss.Storage.GetFeeds()
+		var list = []apiFeed{}
+		for _, id := range sortedFeedIDs(feeds) {
+			list = append(list, apiFeedOf(id, feeds[id], now))
+		}
+		ctx.JSON(http.StatusOK, list)
+	})
+
+	api.POST("/feeds", func(ctx *gin.Context) {
+		var request apiNewFeed
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		request.Url = strings.TrimSpace(request.Url)
+		backlog, backlogError := request.Backlog.toStorage()
+		settings, settingsError := request.Settings.toStorage(storage.FeedSettings{})
+		if err := errors.Join(rssreader.ValidateURL(request.Url), backlogError, settingsError); err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if len(request.Group) != 0 && rss.Storage.GetGroups()[request.Group] == nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, storage.ErrGroupNotFound)
+			return
+		}
+		request.DisplayName = strings.TrimSpace(request.DisplayName)
+		for _, feed := range rss.Storage.GetFeeds() {
+			if feed.Url == request.Url {
+				abortWithAPIError(ctx, http.StatusConflict, fmt.Errorf("%s is already subscribed as %s", request.Url, feed.Name()))
+				return
+			}
+		}
+
+		feed, err := rss.AddFeed(request.Url, rssreader.NewFeed{
+			Backlog:     backlog,
+			Settings:    settings,
+			DisplayName: request.DisplayName,
+			Group:       request.Group,
+			Tags:        request.Tags,
+		})
+		if feed == nil {
+			logger.Warn("Failed to add feed", "url", request.Url, "error", err)
+			abortWithAPIError(ctx, http.StatusUnprocessableEntity, err)
+			return
+		}
+		var id = feed.GetID()
+		if err != nil {
+			logger.Error("Failed to save feed", logging.Feed(id), "error", err)
+			abortWithAPIError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		ctx.JSON(http.StatusCreated, apiFeedOf(id, rss.Storage.GetFeedByID(id), time.Now()))
+	})
+
+	api.POST("/check", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, apiPollSummaryOf(rss.CheckAllNow()))
+	})
+
+	var feedGroup = api.Group("/feeds/:feedID", func(ctx *gin.Context) {
+		id, err := strconv.Atoi(ctx.Param("feedID"))
+		if err != nil || rss.Storage.GetFeedByID(id) == nil {
+			abortWithAPIError(ctx, http.StatusNotFound, storage.ErrFeedNotFound)
+			return
+		}
+		ctx.Set("ID", id)
+		ctx.Next()
+	})
+
+	feedGroup.GET("", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		ctx.JSON(http.StatusOK, apiFeedOf(id, rss.Storage.GetFeedByID(id), time.Now()))
+	})
+
+	feedGroup.PATCH("", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var patch apiFeedPatch
+		if err := ctx.ShouldBindJSON(&patch); err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		// Everything is checked before anything is changed, then the changes are saved together.
+		var edit = storage.FeedEdit{Group: patch.Group, Tags: patch.Tags}
+		if edit.Group != nil && len(*edit.Group) != 0 && rss.Storage.GetGroups()[*edit.Group] == nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, storage.ErrGroupNotFound)
+			return
+		}
+		if patch.Settings != nil {
+			settings, err := patch.Settings.toStorage(rss.Storage.GetFeedByID(id).Settings)
+			if err != nil {
+				abortWithAPIError(ctx, http.StatusBadRequest, err)
+				return
+			}
+			edit.Settings = &settings
+		}
+		if patch.DisplayName != nil {
+			var displayName = strings.TrimSpace(*patch.DisplayName)
+			edit.DisplayName = &displayName
+		}
+		if patch.Url != nil {
+			urlEdit, err := rss.FeedUrlEdit(id, strings.TrimSpace(*patch.Url))
+			if err != nil {
+				abortWithAPIError(ctx, http.StatusUnprocessableEntity, err)
+				return
+			}
+			edit.Url, edit.KeepHistory, edit.Meta = urlEdit.Url, urlEdit.KeepHistory, urlEdit.Meta
+		}
+
+		var err = rss.Storage.EditFeed(id, edit)
+		if errors.Is(err, storage.ErrGroupNotFound) {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to edit feed", logging.Feed(id), "error", err)
+			abortWithAPIError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, apiFeedOf(id, rss.Storage.GetFeedByID(id), time.Now()))
+	})
+
+	feedGroup.DELETE("", func(ctx *gin.Context) {
+		if err := rss.Storage.RemoveFeedByID(ctx.GetInt("ID")); err != nil {
+			abortWithAPIError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	})
+
+	feedGroup.GET("/health", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, apiHealthOf(rss.Storage.GetFeedByID(ctx.GetInt("ID")), time.Now()))
+	})
+
+	feedGroup.POST("/check", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, apiPollSummaryOf(rss.CheckFeed(ctx.GetInt("ID"))))
+	})
+
+	api.GET("/settings", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, apiSettingsOf(rss.Storage.GetSettings()))
+	})
+
+	api.PUT("/settings", func(ctx *gin.Context) {
+		var request apiSettings
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		var settings = rss.Storage.GetSettings()
+		if err := request.applyTo(&settings); err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if err := rss.Storage.SaveSettings(settings); err != nil {
+			abortWithAPIError(ctx, http.StatusInternalServerError, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, apiSettingsOf(rss.Storage.GetSettings()))
+	})
+
+	api.GET("/token", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, apiToken{Set: len(rss.Storage.GetClientToken()) != 0})
+	})
+
+	api.PUT("/token", func(ctx *gin.Context) {
+		var request struct {
+			Token string `json:"token"`
+		}
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		if len(request.Token) == 0 {
+			abortWithAPIError(ctx, http.StatusBadRequest, errors.New("token is required"))
+			return
+		}
+		if err := updateDefaultToken(ctx.GetString("token"), request.Token); err != nil {
+			logger.Error("Failed to update token", "error", err)
+			abortWithAPIError(ctx, http.StatusUnprocessableEntity, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, apiToken{Set: true})
+	})
+
+	api.GET("/logs", func(ctx *gin.Context) {
+		filter, err := logFilterFrom(ctx.Request.URL.Query(), time.Now())
+		if err != nil {
+			abortWithAPIError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		var entries = []apiLogEntry{}
+		for _, entry := range logRing.Entries(filter) {
+			var converted = apiLogEntry{Time: entry.Time, Level: entry.Level.String(), Message: entry.Message, Attrs: map[string]string{}}
+			if entry.HasFeed {
+				var id = entry.FeedID
+				converted.Feed = &id
+			}
+			for _, attr := range entry.Attrs {
+				converted.Attrs[attr.Key] = attr.Value.String()
+			}
+			entries = append(entries, converted)
+		}
+		ctx.JSON(http.StatusOK, entries)
+	})
+}
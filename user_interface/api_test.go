@@ -0,0 +1,172 @@
+package user_interface
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/CEKlopfenstein/simple-feeds/rssreader"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAPI(t *testing.T) (*gin.Engine, *rssreader.RSS_Reader) {
+	gin.SetMode(gin.TestMode)
+	var logger = slog.New(slog.DiscardHandler)
+	var rss rssreader.RSS_Reader
+	rss.SetLogger(logger)
+	rss.SetStorage(storage.NewMemoryStorage(logger))
+	var engine = gin.New()
+	buildAPI(engine.Group(apiPath), &rss, logger, logging.NewRing(10), func(string, string) error { return nil })
+	return engine, &rss
+}
+
+func apiRequest(engine *gin.Engine, method string, path string, body string) *httptest.ResponseRecorder {
+	var recorder = httptest.NewRecorder()
+	var request = httptest.NewRequest(method, apiPath+path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAPIFeeds(t *testing.T) {
+	engine, rss := testAPI(t)
+	feed, err := rss.Storage.SaveNewFeed("https://example.com/feed", storage.FeedMeta{Title: "Example"}, nil)
+	require.NoError(t, err)
+	var id = feed.GetID()
+
+	var response = apiRequest(engine, http.MethodGet, "/feeds", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var feeds []apiFeed
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &feeds))
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "Example", feeds[0].Name)
+	assert.Equal(t, storage.HealthNever, feeds[0].Health.Status)
+
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"displayName": " Renamed ", "settings": {"priority": 7}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Renamed", rss.Storage.GetFeedByID(id).DisplayName)
+	assert.Equal(t, 7, *rss.Storage.GetFeedByID(id).Settings.Priority)
+
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"settings": {"pollMinutes": 0}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	// Nothing is changed when any part of the edit fails.
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"displayName": "Again", "url": "ftp://example.com/feed"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"displayName": "Again", "group": "Missing"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "Renamed", rss.Storage.GetFeedByID(id).DisplayName)
+
+	response = apiRequest(engine, http.MethodPost, "/feeds", `{"url": "https://example.com/feed"}`)
+	assert.Equal(t, http.StatusConflict, response.Code)
+	response = apiRequest(engine, http.MethodPost, "/feeds", `{"url": "ftp://example.com/feed"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	response = apiRequest(engine, http.MethodPost, "/feeds", `{"url": "https://example.com/other", "backlog": {"mode": "latest"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+
+	response = apiRequest(engine, http.MethodGet, "/feeds/5", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	var apiErr apiError
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &apiErr))
+	assert.Equal(t, apiError{Error: "Not Found", ErrorCode: http.StatusNotFound, ErrorDescription: storage.ErrFeedNotFound.Error()}, apiErr)
+
+	response = apiRequest(engine, http.MethodDelete, "/feeds/0", "")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Nil(t, rss.Storage.GetFeedByID(id))
+}
+
+func TestAPISettings(t *testing.T) {
+	engine, rss := testAPI(t)
+
+	var response = apiRequest(engine, http.MethodPut, "/settings", `{"pollMinutes": 30, "priority": 4, "rateLimitPerMinute": 10}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 30, rss.Storage.GetSettings().PollMinutes)
+	assert.Equal(t, 4, rss.Storage.GetSettings().Priority)
+
+	response = apiRequest(engine, http.MethodPut, "/settings", `{"pollMinutes": 30, "priority": -1}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	response = apiRequest(engine, http.MethodPut, "/settings", `{"pollMinutes": 0}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, 4, rss.Storage.GetSettings().Priority)
+
+	response = apiRequest(engine, http.MethodPut, "/settings", `{"priority": 6}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, 6, rss.Storage.GetSettings().Priority)
+	assert.Equal(t, 30, rss.Storage.GetSettings().PollMinutes)
+	assert.Equal(t, 10, rss.Storage.GetSettings().RateLimitPerMinute)
+}
+
+func TestAPIHidesAppTokens(t *testing.T) {
+	engine, rss := testAPI(t)
+	_, err := rss.Storage.SaveNewFeed("https://example.com/feed", storage.FeedMeta{}, nil)
+	require.NoError(t, err)
+
+	var response = apiRequest(engine, http.MethodPut, "/settings", `{"appToken": " secret "}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotContains(t, response.Body.String(), "secret")
+	assert.Contains(t, response.Body.String(), `"appTokenSet":true`)
+	response = apiRequest(engine, http.MethodPut, "/settings", `{"priority": 3}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "secret", rss.Storage.GetSettings().AppToken)
+	response = apiRequest(engine, http.MethodPut, "/settings", `{"appToken": ""}`)
+	assert.Contains(t, response.Body.String(), `"appTokenSet":false`)
+	assert.Empty(t, rss.Storage.GetSettings().AppToken)
+
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"settings": {"appToken": "secret"}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotContains(t, response.Body.String(), "secret")
+	assert.Contains(t, response.Body.String(), `"appTokenSet":true`)
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"settings": {"priority": 2}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "secret", *rss.Storage.GetFeedByID(0).Settings.AppToken)
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"settings": {"appToken": null}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "secret", *rss.Storage.GetFeedByID(0).Settings.AppToken)
+	response = apiRequest(engine, http.MethodPatch, "/feeds/0", `{"settings": {"appToken": ""}}`)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Nil(t, rss.Storage.GetFeedByID(0).Settings.AppToken)
+
+	response = apiRequest(engine, http.MethodGet, "/feeds", "")
+	assert.NotContains(t, response.Body.String(), "appToken\"")
+}
+
+func TestAPIBacklog(t *testing.T) {
+	policy, err := (*apiBacklog)(nil).toStorage()
+	assert.NoError(t, err)
+	assert.Equal(t, storage.BacklogNone, policy.Mode)
+
+	policy, err = (&apiBacklog{Mode: "latest", Count: 3}).toStorage()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, policy.Count)
+
+	policy, err = (&apiBacklog{Mode: "since", Since: "2024-03-01"}).toStorage()
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-01", policy.Since.Format("2006-01-02"))
+
+	_, err = (&apiBacklog{Mode: "since", Since: "March"}).toStorage()
+	assert.Error(t, err)
+	_, err = (&apiBacklog{Mode: "everything"}).toStorage()
+	assert.Error(t, err)
+}
+
+// Every route of the API is described by the OpenAPI document.
+func TestOpenAPIDocument(t *testing.T) {
+	var document struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(openAPIDocument, &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+
+	engine, _ := testAPI(t)
+	for _, route := range engine.Routes() {
+		var path = strings.ReplaceAll(strings.TrimPrefix(route.Path, apiPath), ":feedID", "{feedID}")
+		assert.Contains(t, document.Paths[path], strings.ToLower(route.Method), route.Method+" "+route.Path)
+	}
+}
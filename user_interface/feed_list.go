@@ -0,0 +1,170 @@
+package user_interface
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/rssreader"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// Number of feeds on a page of the feed list.
+const feedsPerPage = 20
+
+// The search, filter, sort and page of the feed list. Read from and written to the query string so it can be bookmarked.
+type feedListQuery struct {
+	Search string
+	// One of the storage health values or blank for every feed.
+	Health string
+	// "name", "url", "last-post" or "last-error".
+	Sort string
+	Page int
+}
+
+func feedListQueryFrom(values url.Values) feedListQuery {
+	var query = feedListQuery{
+		Search: strings.TrimSpace(values.Get("q")),
+		Health: values.Get("health"),
+		Sort:   values.Get("sort"),
+	}
+	switch query.Health {
+	case storage.HealthOK, storage.HealthFailing, storage.HealthNever, storage.HealthPaused:
+	default:
+		query.Health = ""
+	}
+	switch query.Sort {
+	case "url", "last-post", "last-error":
+	default:
+		query.Sort = "name"
+	}
+	query.Page, _ = strconv.Atoi(values.Get("page"))
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	return query
+}
+
+// Encode writes the query back as a query string, leaving out default values.
+func (query feedListQuery) Encode() string {
+	var values = url.Values{}
+	if len(query.Search) != 0 {
+		values.Set("q", query.Search)
+	}
+	if len(query.Health) != 0 {
+		values.Set("health", query.Health)
+	}
+	if query.Sort != "name" {
+		values.Set("sort", query.Sort)
+	}
+	if query.Page > 1 {
+		values.Set("page", strconv.Itoa(query.Page))
+	}
+	return values.Encode()
+}
+
+func (query feedListQuery) WithPage(page int) feedListQuery {
+	query.Page = page
+	return query
+}
+
+// Applies the search, filter and sort of the query. Returns the IDs of the feeds on the page of the query
+// and the number of feeds matching. The page of the query is clamped to the pages available.
+func (query *feedListQuery) apply(feeds map[int]*storage.Feed, now time.Time) ([]int, int) {
+	var search = strings.ToLower(query.Search)
+	var ids = []int{}
+	for id, feed := range feeds {
+		if len(search) != 0 && !strings.Contains(strings.ToLower(feed.Name()), search) && !strings.Contains(strings.ToLower(feed.Url), search) {
+			continue
+		}
+		if len(query.Health) != 0 && feed.Health(now) != query.Health {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		var first, second = feeds[ids[i]], feeds[ids[j]]
+		switch query.Sort {
+		case "url":
+			if first.Url != second.Url {
+				return first.Url < second.Url
+			}
+		case "last-post":
+			if order, differ := newestFirst(first.LastDate, second.LastDate); differ {
+				return order
+			}
+		case "last-error":
+			if order, differ := newestFirst(first.LastErrorAt, second.LastErrorAt); differ {
+				return order
+			}
+		default:
+			var firstName, secondName = strings.ToLower(first.Name()), strings.ToLower(second.Name())
+			if firstName != secondName {
+				return firstName < secondName
+			}
+		}
+		return ids[i] < ids[j]
+	})
+
+	if pages := pageCount(len(ids)); query.Page > pages {
+		query.Page = pages
+	}
+	var start = (query.Page - 1) * feedsPerPage
+	var end = min(start+feedsPerPage, len(ids))
+	return ids[start:end], len(ids)
+}
+
+// Number of pages needed for the feeds. Always at least one.
+func pageCount(feeds int) int {
+	return max(1, (feeds+feedsPerPage-1)/feedsPerPage)
+}
+
+// Orders times newest first with missing times last. Reports whether the times differ.
+func newestFirst(first *time.Time, second *time.Time) (bool, bool) {
+	switch {
+	case first == nil && second == nil:
+		return false, false
+	case first == nil || second == nil:
+		return first != nil, true
+	case first.Equal(*second):
+		return false, false
+	}
+	return first.After(*second), true
+}
+
+// What a bulk action will change, shown for confirmation.
+type bulkConfirmData struct {
+	// "delete" or "replace".
+	Action  string
+	Ids     []int
+	Find    string
+	Replace string
+	// The feeds to delete, or the URLs to change.
+	Changes []rssreader.UrlChange
+	// Number of selected feeds the action leaves as they are.
+	Unchanged int
+	// The feed list is shown like this once the action is applied.
+	Query feedListQuery
+}
+
+// The IDs of the feeds selected in the feed list.
+func selectedFeedIDs(ctx *gin.Context) ([]int, error) {
+	var ids = []int{}
+	for _, value := range ctx.PostFormArray("feed") {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid feed %q", value)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no feeds are selected")
+	}
+	return ids, nil
+}
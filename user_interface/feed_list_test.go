@@ -0,0 +1,52 @@
+package user_interface
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedListQueryRoundTrip(t *testing.T) {
+	var query = feedListQueryFrom(url.Values{"q": {" news "}, "health": {"failing"}, "sort": {"bogus"}, "page": {"3"}})
+	assert.Equal(t, feedListQuery{Search: "news", Health: storage.HealthFailing, Sort: "name", Page: 3}, query)
+	assert.Equal(t, "health=failing&page=3&q=news", query.Encode())
+	assert.Equal(t, "", feedListQueryFrom(url.Values{}).Encode())
+}
+
+func TestFeedListApply(t *testing.T) {
+	var now = time.Now()
+	var earlier = now.Add(-time.Hour)
+	var feeds = map[int]*storage.Feed{}
+	for id := 0; id < 25; id++ {
+		feeds[id] = &storage.Feed{Url: fmt.Sprintf("https://example.com/%02d", id), Meta: storage.FeedMeta{Title: fmt.Sprintf("Feed %02d", 24-id)}, LastSuccess: &now}
+	}
+	feeds[3].Failures = 1
+	feeds[3].LastErrorAt = &earlier
+	feeds[7].Failures = 2
+	feeds[7].LastErrorAt = &now
+
+	var query = feedListQuery{Sort: "name", Page: 1}
+	ids, total := query.apply(feeds, now)
+	assert.Equal(t, 25, total)
+	assert.Equal(t, 2, pageCount(total))
+	assert.Len(t, ids, feedsPerPage)
+	assert.Equal(t, 24, ids[0])
+
+	query = feedListQuery{Sort: "name", Page: 9}
+	ids, _ = query.apply(feeds, now)
+	assert.Equal(t, 2, query.Page)
+	assert.Len(t, ids, 5)
+
+	query = feedListQuery{Health: storage.HealthFailing, Sort: "last-error", Page: 1}
+	ids, _ = query.apply(feeds, now)
+	assert.Equal(t, []int{7, 3}, ids)
+
+	query = feedListQuery{Search: "FEED 1", Sort: "url", Page: 1}
+	ids, _ = query.apply(feeds, now)
+	assert.Len(t, ids, 10)
+	assert.Equal(t, 5, ids[0])
+}
@@ -0,0 +1,56 @@
+package user_interface
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/events"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+)
+
+// How often a comment is sent on an idle event stream so that proxies keep it open.
+const keepAliveInterval = 30 * time.Second
+
+// A message of the event stream of the config page.
+type liveMessage struct {
+	Name string
+	Data string
+}
+
+// The JSON sent for each event under the name of its kind.
+type liveEvent struct {
+	Time   time.Time `json:"time"`
+	Feed   *int      `json:"feed"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// The messages an event is sent as. Every event is sent as JSON under the name of its kind. A log entry is also sent
+// as its row of the log view as "log-row". The end of a poll also sends the card of the feed re-rendered as
+// "feed-<id>", as does a delivery to a target, and its start a status as "feed-<id>-polling".
+// renderCard returns false when the feed no longer exists.
+func liveMessages(event events.Event, renderCard func(id int) (string, bool), renderLogRow func(entry logging.Entry) string) []liveMessage {
+	var data = liveEvent{Time: event.Time, Detail: event.Detail}
+	if event.HasFeed {
+		data.Feed = &event.FeedID
+	}
+	encoded, _ := json.Marshal(data)
+	var messages = []liveMessage{{Name: event.Kind, Data: string(encoded)}}
+	if event.Kind == events.LogEntry && event.Entry != nil {
+		messages = append(messages, liveMessage{Name: "log-row", Data: renderLogRow(*event.Entry)})
+	}
+	if !event.HasFeed {
+		return messages
+	}
+
+	var cardName = fmt.Sprintf("feed-%d", event.FeedID)
+	switch event.Kind {
+	case events.PollStart:
+		messages = append(messages, liveMessage{Name: cardName + "-polling", Data: "Checking now…"})
+	case events.PollFinish, events.Forwarded:
+		if card, ok := renderCard(event.FeedID); ok {
+			messages = append(messages, liveMessage{Name: cardName, Data: card})
+		}
+	}
+	return messages
+}
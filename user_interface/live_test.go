@@ -0,0 +1,45 @@
+package user_interface
+
+import (
+	"testing"
+
+	"github.com/CEKlopfenstein/simple-feeds/events"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveMessages(t *testing.T) {
+	var renderCard = func(id int) (string, bool) {
+		return "<div>card</div>", id == 0
+	}
+	var renderLogRow = func(entry logging.Entry) string {
+		return "<tr><td>" + entry.Message + "</td></tr>"
+	}
+
+	var messages = liveMessages(events.About(events.PollStart, 0, "https://example.com/feed"), renderCard, renderLogRow)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, events.PollStart, messages[0].Name)
+	assert.Contains(t, messages[0].Data, `"feed":0`)
+	assert.Contains(t, messages[0].Data, `"detail":"https://example.com/feed"`)
+	assert.Equal(t, "feed-0-polling", messages[1].Name)
+
+	messages = liveMessages(events.About(events.PollFinish, 0, ""), renderCard, renderLogRow)
+	assert.Equal(t, []string{events.PollFinish, "feed-0"}, names(messages))
+	assert.Equal(t, "<div>card</div>", messages[1].Data)
+
+	// A feed deleted while it was polled has no card to send.
+	assert.Equal(t, []string{events.PollFinish}, names(liveMessages(events.About(events.PollFinish, 3, ""), renderCard, renderLogRow)))
+
+	messages = liveMessages(events.Event{Kind: events.LogEntry, Detail: "Plugin Enabled", Entry: &logging.Entry{Message: "Plugin Enabled"}}, renderCard, renderLogRow)
+	assert.Equal(t, []string{events.LogEntry, "log-row"}, names(messages))
+	assert.Contains(t, messages[0].Data, `"feed":null`)
+	assert.Equal(t, "<tr><td>Plugin Enabled</td></tr>", messages[1].Data)
+}
+
+func names(messages []liveMessage) []string {
+	var found = []string{}
+	for _, message := range messages {
+		found = append(found, message.Name)
+	}
+	return found
+}
@@ -0,0 +1,86 @@
+package user_interface
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+)
+
+// Reads the level, feed and since filters of the log view. Since is either a duration back from now or an RFC 3339 time.
+func logFilterFrom(values url.Values, now time.Time) (logging.Filter, error) {
+	var filter = logging.Filter{Level: slog.LevelInfo}
+	if level := values.Get("level"); len(level) != 0 {
+		if err := filter.Level.UnmarshalText([]byte(level)); err != nil {
+			return filter, fmt.Errorf("invalid level %q", level)
+		}
+	}
+	if feed := values.Get("feed"); len(feed) != 0 {
+		id, err := strconv.Atoi(feed)
+		if err != nil || id < 0 {
+			return filter, fmt.Errorf("invalid feed %q", feed)
+		}
+		filter.FeedID = &id
+	}
+	if since := values.Get("since"); len(since) != 0 {
+		if duration, err := time.ParseDuration(since); err == nil && duration > 0 {
+			filter.Since = now.Add(-duration)
+		} else if at, err := time.Parse(time.RFC3339, since); err == nil {
+			filter.Since = at
+		} else {
+			return filter, fmt.Errorf("invalid since %q", since)
+		}
+	}
+	return filter, nil
+}
+
+type logRow struct {
+	Time  string
+	Level string
+	// The level as a number, for the log view to tell whether a pushed row matches its filter.
+	LevelValue int
+	Message    string
+	HasFeed    bool
+	FeedID     int
+	Feed       string
+	Attrs      string
+}
+
+type logEntriesData struct {
+	Rows []logRow
+	// Hides the feed column when only a single feed is shown.
+	SingleFeed bool
+	// Rows pushed to the view beyond this drop the oldest ones.
+	MaxRows int
+	Error   string
+}
+
+// Turns log entries into rows, newest first. Feeds are named by feedName.
+func logRows(entries []logging.Entry, feedName func(id int) string) []logRow {
+	var rows = make([]logRow, 0, len(entries))
+	for index := len(entries) - 1; index >= 0; index-- {
+		var entry = entries[index]
+		var attrs = make([]string, 0, len(entry.Attrs))
+		for _, attr := range entry.Attrs {
+			attrs = append(attrs, attr.String())
+		}
+		var row = logRow{
+			Time:       entry.Time.Local().Format("2006-01-02 15:04:05"),
+			Level:      entry.Level.String(),
+			LevelValue: int(entry.Level),
+			Message:    entry.Message,
+			HasFeed:    entry.HasFeed,
+			Attrs:      strings.Join(attrs, " "),
+		}
+		if entry.HasFeed {
+			row.FeedID = entry.FeedID
+			row.Feed = feedName(entry.FeedID)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,59 @@
+package user_interface
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFilterFrom(t *testing.T) {
+	var now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	filter, err := logFilterFrom(url.Values{}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, logging.Filter{Level: slog.LevelInfo}, filter)
+
+	filter, err = logFilterFrom(url.Values{"level": {"warn"}, "feed": {"3"}, "since": {"1h"}}, now)
+	assert.NoError(t, err)
+	var feed = 3
+	assert.Equal(t, logging.Filter{Level: slog.LevelWarn, FeedID: &feed, Since: now.Add(-time.Hour)}, filter)
+
+	filter, err = logFilterFrom(url.Values{"since": {"2024-02-01T00:00:00Z"}}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), filter.Since)
+
+	for _, values := range []url.Values{{"level": {"loud"}}, {"feed": {"x"}}, {"since": {"yesterday"}}} {
+		_, err = logFilterFrom(values, now)
+		assert.Error(t, err, values.Encode())
+	}
+}
+
+func TestLogRowsNewestFirst(t *testing.T) {
+	var start = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var entries = []logging.Entry{
+		{Time: start, Level: slog.LevelInfo, Message: "first"},
+		{Time: start.Add(time.Minute), Level: slog.LevelWarn, Message: "second", HasFeed: true, FeedID: 2, Attrs: []slog.Attr{slog.String("url", "https://example.com")}},
+	}
+	var rows = logRows(entries, func(id int) string { return "Example" })
+	assert.Equal(t, "second", rows[0].Message)
+	assert.Equal(t, "Example", rows[0].Feed)
+	assert.Equal(t, "url=https://example.com", rows[0].Attrs)
+	assert.Equal(t, "", rows[1].Feed)
+
+	// Pushed rows carry what the log view filters on.
+	tmpl, err := template.New("").Parse(logEntriesBody)
+	require.NoError(t, err)
+	var row = new(bytes.Buffer)
+	require.NoError(t, tmpl.ExecuteTemplate(row, "log-row", rows[0]))
+	assert.Contains(t, row.String(), `data-level="4" data-feed="2"`)
+	row.Reset()
+	require.NoError(t, tmpl.ExecuteTemplate(row, "log-row", rows[1]))
+	assert.Contains(t, row.String(), `data-level="0" data-feed=""`)
+}
@@ -1,3 +1,119 @@
 htmx.onLoad((elt) => {
-    
-})
\ No newline at end of file
+    // Webhook paths are shown as the full address senders need.
+    elt.querySelectorAll("[data-absolute-url]").forEach((element) => {
+        element.textContent = new URL(element.dataset.absoluteUrl, window.location.href).href
+    })
+})
+
+// Live updates arrive over the sse extension of htmx. Cards being worked with are left as they are rather than
+// replaced under the user, and pushed log rows are only added to the log views whose filters they match.
+(() => {
+    const levels = { debug: -4, info: 0, warn: 4, error: 8 }
+
+    function inUse(element) {
+        return element.matches(":focus-within") || element.querySelector("details[open], input:checked") != null
+    }
+
+    function matchesLogView(view, html) {
+        const template = document.createElement("template")
+        template.innerHTML = html.trim()
+        const row = template.content.querySelector("tr")
+        const level = view.querySelector('[name="level"]')
+        const feed = view.querySelector('[name="feed"]')
+        return row != null && Number(row.dataset.level) >= levels[level.value] && (feed.value === "" || row.dataset.feed === feed.value)
+    }
+
+    document.addEventListener("htmx:sseBeforeMessage", (event) => {
+        const message = event.detail
+        if (message.type === "log-row") {
+            const view = event.target.closest(".log-view")
+            if (view != null && !matchesLogView(view, message.data)) {
+                event.preventDefault()
+            }
+            return
+        }
+        const swapped = [event.target, ...event.target.querySelectorAll("[sse-swap]")]
+            .filter((element) => element.getAttribute("sse-swap") === message.type)
+        if (swapped.some(inUse)) {
+            event.preventDefault()
+        }
+    })
+
+    // A log view keeps no more rows than the plugin keeps log entries.
+    document.addEventListener("htmx:sseMessage", (event) => {
+        if (event.detail.type !== "log-row") {
+            return
+        }
+        const view = event.target.closest(".log-view")
+        if (view == null) {
+            return
+        }
+        view.querySelectorAll(".log-empty").forEach((element) => element.remove())
+        view.querySelectorAll("tbody[data-max-rows]").forEach((rows) => {
+            while (rows.rows.length > Number(rows.dataset.maxRows)) {
+                rows.lastElementChild.remove()
+            }
+        })
+    })
+})()
+
+// Refused requests, such as edits with an unknown group or uploads that are too large, are answered with an error
+// status along with the error to show in place of the result.
+document.addEventListener("htmx:beforeSwap", (event) => {
+    if (event.detail.xhr.status >= 400 && (event.detail.xhr.getResponseHeader("Content-Type") || "").startsWith("text/html")) {
+        event.detail.shouldSwap = true
+        event.detail.isError = false
+    }
+})
+
+// Downloads a file from the plugin. A plain link would not send the Gotify key header.
+function downloadFile(path, filename) {
+    fetch(path, { headers: { "X-Gotify-Key": localStorage.getItem("gotify-login-key") } })
+        .then((response) => {
+            if (!response.ok) {
+                throw new Error(response.statusText)
+            }
+            return response.blob()
+        })
+        .then((blob) => {
+            const link = document.createElement("a")
+            link.href = URL.createObjectURL(blob)
+            link.download = filename
+            link.click()
+            URL.revokeObjectURL(link.href)
+        })
+        .catch((err) => alert("Download failed: " + err.message))
+}
+
+// Checks or unchecks every feed card in the feed list for the bulk actions.
+function selectAllFeeds(checked) {
+    document.querySelectorAll('input[name="feed"][form="bulk-actions"]').forEach((checkbox) => checkbox.checked = checked)
+}
+
+// The feeds checked for the bulk actions as a query string.
+function selectedFeeds() {
+    const query = new URLSearchParams()
+    document.querySelectorAll('input[name="feed"][form="bulk-actions"]:checked').forEach((checkbox) => query.append("feed", checkbox.value))
+    return query.toString()
+}
+
+// Downloads the feeds checked for the bulk actions as OPML.
+function exportSelectedFeeds() {
+    const query = selectedFeeds()
+    if (query.length == 0) {
+        alert("No feeds are selected.")
+        return
+    }
+    downloadFile("opml?" + query, "simple-feeds-selection.opml")
+}
+
+// Counts down the time left on elements with a data-countdown attribute holding a unix timestamp.
+setInterval(() => {
+    document.querySelectorAll("[data-countdown]").forEach((element) => {
+        let left = Math.max(0, Number(element.dataset.countdown) - Math.floor(Date.now() / 1000))
+        const hours = Math.floor(left / 3600)
+        const minutes = Math.floor((left % 3600) / 60)
+        const seconds = left % 60
+        element.textContent = (hours > 0 ? hours + "h" : "") + (hours > 0 || minutes > 0 ? minutes + "m" : "") + seconds + "s"
+    })
+}, 1000)
@@ -0,0 +1,57 @@
+package user_interface
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Name of the cookie that lets the config page open its event stream.
+const eventSessionCookie = "simple-feeds-events"
+
+// How long after the config page was loaded its event stream can still be opened, such as to reconnect.
+const eventSessionLifetime = 12 * time.Hour
+
+// An EventSource cannot send the Gotify key as a header. Loading the config page with the key starts a session
+// instead, kept in an HttpOnly cookie sent only to the event stream, that stands for the key until it expires.
+type eventSessions struct {
+	lock     sync.Mutex
+	sessions map[string]eventSession
+}
+
+type eventSession struct {
+	clientKey string
+	expires   time.Time
+}
+
+// Starts a session for the client key and returns its ID. Expired sessions are dropped.
+func (sessions *eventSessions) start(clientKey string, now time.Time) string {
+	var random = make([]byte, 32)
+	rand.Read(random)
+	var id = hex.EncodeToString(random)
+
+	sessions.lock.Lock()
+	defer sessions.lock.Unlock()
+	if sessions.sessions == nil {
+		sessions.sessions = map[string]eventSession{}
+	}
+	for other, session := range sessions.sessions {
+		if !now.Before(session.expires) {
+			delete(sessions.sessions, other)
+		}
+	}
+	sessions.sessions[id] = eventSession{clientKey: clientKey, expires: now.Add(eventSessionLifetime)}
+	return id
+}
+
+// Returns the client key of a session that has not expired.
+func (sessions *eventSessions) clientKey(id string, now time.Time) (string, bool) {
+	sessions.lock.Lock()
+	defer sessions.lock.Unlock()
+	session, found := sessions.sessions[id]
+	if !found || !now.Before(session.expires) {
+		return "", false
+	}
+	return session.clientKey, true
+}
@@ -0,0 +1,32 @@
+package user_interface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventSessions(t *testing.T) {
+	var sessions = new(eventSessions)
+	var now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var first = sessions.start("key-1", now)
+	var second = sessions.start("key-2", now.Add(time.Hour))
+	assert.NotEqual(t, first, second)
+	assert.Len(t, first, 64)
+
+	clientKey, found := sessions.clientKey(first, now.Add(time.Minute))
+	assert.True(t, found)
+	assert.Equal(t, "key-1", clientKey)
+	_, found = sessions.clientKey("unknown", now)
+	assert.False(t, found)
+
+	// Sessions expire, and expired ones are dropped once another starts.
+	_, found = sessions.clientKey(first, now.Add(eventSessionLifetime))
+	assert.False(t, found)
+	sessions.start("key-3", now.Add(eventSessionLifetime))
+	assert.Len(t, sessions.sessions, 2)
+	clientKey, _ = sessions.clientKey(second, now.Add(eventSessionLifetime))
+	assert.Equal(t, "key-2", clientKey)
+}
@@ -0,0 +1,167 @@
+package user_interface
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+)
+
+// Size of a sparkline in SVG user units.
+const (
+	sparklineWidth  = 120
+	sparklineHeight = 24
+)
+
+type statsPeriod struct {
+	Name       string
+	Stats      storage.DailyStats
+	AvgLatency string
+	Bytes      string
+}
+
+type statsSparkline struct {
+	Name   string
+	Points string
+	Total  int
+}
+
+type latencyBucket struct {
+	Label   string
+	Count   int
+	Percent int
+}
+
+type feedStatsRow struct {
+	Id         int
+	Name       string
+	Stats      storage.DailyStats
+	AvgLatency string
+	Bytes      string
+	// Sparkline of the new items per day.
+	Points string
+}
+
+type statsData struct {
+	Days       int
+	Periods    []statsPeriod
+	Sparklines []statsSparkline
+	Latency    []latencyBucket
+	Feeds      []feedStatsRow
+}
+
+func buildStatsData(store storage.Storage, now time.Time) statsData {
+	var totals = store.GetTotalStats()
+	var data = statsData{Days: storage.StatsDays}
+	for _, period := range []struct {
+		name string
+		days int
+	}{{"Today", 1}, {"Last 7 days", 7}, {fmt.Sprintf("Last %d days", storage.StatsDays), storage.StatsDays}} {
+		var stats = storage.StatsSince(totals, now.AddDate(0, 0, 1-period.days))
+		data.Periods = append(data.Periods, statsPeriod{Name: period.name, Stats: stats, AvgLatency: formatLatency(stats.AverageLatency()), Bytes: formatBytes(stats.Bytes)})
+	}
+
+	var series = storage.StatsSeries(totals, now, storage.StatsDays)
+	for _, line := range []struct {
+		name  string
+		value func(storage.DailyStats) int
+	}{
+		{"Polls", func(day storage.DailyStats) int { return day.Polls }},
+		{"New items", func(day storage.DailyStats) int { return day.NewItems }},
+		{"Delivered", func(day storage.DailyStats) int { return day.Delivered }},
+		{"Errors", func(day storage.DailyStats) int { return day.ParseErrors }},
+	} {
+		var values = make([]int, len(series))
+		var total = 0
+		for index, day := range series {
+			values[index] = line.value(day)
+			total += values[index]
+		}
+		data.Sparklines = append(data.Sparklines, statsSparkline{Name: line.name, Points: sparklinePoints(values), Total: total})
+	}
+
+	var month = data.Periods[len(data.Periods)-1].Stats
+	var fetches = 0
+	for _, count := range month.Latency {
+		fetches += count
+	}
+	for index, count := range month.Latency {
+		var bucket = latencyBucket{Count: count}
+		if index < len(storage.LatencyBounds) {
+			bucket.Label = "Up to " + formatLatency(storage.LatencyBounds[index])
+		} else {
+			bucket.Label = "Over " + formatLatency(storage.LatencyBounds[len(storage.LatencyBounds)-1])
+		}
+		if fetches > 0 {
+			bucket.Percent = count * 100 / fetches
+		}
+		data.Latency = append(data.Latency, bucket)
+	}
+
+	for id, feed := range store.GetFeeds() {
+		var days = store.GetStats(id)
+		var stats = storage.StatsSince(days, now.AddDate(0, 0, 1-storage.StatsDays))
+		var newItems = []int{}
+		for _, day := range storage.StatsSeries(days, now, storage.StatsDays) {
+			newItems = append(newItems, day.NewItems)
+		}
+		data.Feeds = append(data.Feeds, feedStatsRow{
+			Id:         id,
+			Name:       feed.Name(),
+			Stats:      stats,
+			AvgLatency: formatLatency(stats.AverageLatency()),
+			Bytes:      formatBytes(stats.Bytes),
+			Points:     sparklinePoints(newItems),
+		})
+	}
+	sort.Slice(data.Feeds, func(i, j int) bool {
+		if data.Feeds[i].Stats.Polls != data.Feeds[j].Stats.Polls {
+			return data.Feeds[i].Stats.Polls > data.Feeds[j].Stats.Polls
+		}
+		return data.Feeds[i].Id < data.Feeds[j].Id
+	})
+	return data
+}
+
+// Points of an SVG polyline drawing the values left to right, scaled to the largest value.
+func sparklinePoints(values []int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var highest = 0
+	for _, value := range values {
+		highest = max(highest, value)
+	}
+	var points = make([]string, len(values))
+	for index, value := range values {
+		var x = 0.0
+		if len(values) > 1 {
+			x = float64(index) * sparklineWidth / float64(len(values)-1)
+		}
+		var y = float64(sparklineHeight)
+		if highest > 0 {
+			y -= float64(value) * (sparklineHeight - 2) / float64(highest)
+		}
+		points[index] = fmt.Sprintf("%.1f,%.1f", x, y-1)
+	}
+	return strings.Join(points, " ")
+}
+
+func formatLatency(latency time.Duration) string {
+	if latency < time.Second {
+		return fmt.Sprintf("%d ms", latency.Milliseconds())
+	}
+	return fmt.Sprintf("%.1f s", latency.Seconds())
+}
+
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
@@ -0,0 +1,22 @@
+package user_interface
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparklinePoints(t *testing.T) {
+	assert.Equal(t, "0.0,1.0 60.0,23.0 120.0,12.0", sparklinePoints([]int{2, 0, 1}))
+	assert.Equal(t, "0.0,23.0 120.0,23.0", sparklinePoints([]int{0, 0}))
+	assert.Equal(t, "", sparklinePoints(nil))
+}
+
+func TestFormatStats(t *testing.T) {
+	assert.Equal(t, "250 ms", formatLatency(250*time.Millisecond))
+	assert.Equal(t, "2.5 s", formatLatency(2500*time.Millisecond))
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 MiB", formatBytes(2<<20))
+}
@@ -3,18 +3,26 @@ package user_interface
 import (
 	"bytes"
 	_ "embed"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/CEKlopfenstein/simple-feeds/events"
 	"github.com/CEKlopfenstein/simple-feeds/gotify_api"
+	"github.com/CEKlopfenstein/simple-feeds/logging"
+	"github.com/CEKlopfenstein/simple-feeds/opml"
 	"github.com/CEKlopfenstein/simple-feeds/rssreader"
+	"github.com/CEKlopfenstein/simple-feeds/storage"
 	"github.com/CEKlopfenstein/simple-feeds/structs"
 	"github.com/gin-gonic/gin"
-	"github.com/mmcdole/gofeed"
 )
 
 //go:embed main.html
@@ -23,15 +31,81 @@ var main string
 //go:embed cards/logger-card.html
 var loggerCardBody string
 
+//go:embed cards/log-filter-fields.html
+var logFilterFieldsBody string
+
+//go:embed cards/log-entries.html
+var logEntriesBody string
+
+//go:embed cards/feed-logs.html
+var feedLogsBody string
+
+//go:embed cards/stats-card.html
+var statsCardBody string
+
+//go:embed cards/stats.html
+var statsBody string
+
 //go:embed cards/general-info-card.html
 var generalInfoCardBody string
 
 //go:embed cards/feed-card.html
 var feedCardBody string
 
+//go:embed cards/feed-edit-card.html
+var feedEditCardBody string
+
+//go:embed cards/feed-preview.html
+var feedPreviewBody string
+
+//go:embed cards/feed-candidates.html
+var feedCandidatesBody string
+
+//go:embed cards/feed-items.html
+var feedItemsBody string
+
+//go:embed cards/feed-targets.html
+var feedTargetsBody string
+
+//go:embed cards/target-result.html
+var targetResultBody string
+
+//go:embed cards/feed-list.html
+var feedListBody string
+
+//go:embed cards/bulk-confirm.html
+var bulkConfirmBody string
+
 //go:embed cards/new-feed-card.html
 var newFeedCardBody string
 
+//go:embed cards/backlog-fields.html
+var backlogFieldsBody string
+
+//go:embed cards/feed-settings-fields.html
+var feedSettingsFieldsBody string
+
+//go:embed cards/webhook-fields.html
+var webhookFieldsBody string
+
+//go:embed cards/groups-card.html
+var groupsCardBody string
+
+//go:embed cards/groups-list.html
+var groupsListBody string
+
+//go:embed cards/opml-card.html
+var opmlCardBody string
+
+//go:embed cards/import-report.html
+var importReportBody string
+
+//go:embed cards/settings-card.html
+var settingsCardBody string
+
+//go:embed cards/settings-form.html
+var settingsFormBody string
+
 //go:embed cards/blank-card-wrapper.html
 var blankCardWrapper string
 
@@ -41,6 +115,11 @@ var wrapper string
 //go:embed htmx.min.js
 var htmxMinJS string
 
+// The Server-Sent Events extension of htmx, at the version of htmx.min.js.
+//
+//go:embed sse.js
+var htmxSSEJS string
+
 //go:embed main.js
 var mainJS string
 
@@ -49,6 +128,7 @@ var bootstrap string
 
 type userPage struct {
 	HtmxBasePath string
+	HtmxSSEPath  string
 	Cards        []card
 	MainJSPath   string
 	Bootstrap    string
@@ -60,50 +140,283 @@ type card struct {
 }
 
 type feedCardData struct {
-	Id        int
-	LastFound string
-	TimeSince string
-	Url       string
-	Descript  string
-	Title     string
+	Id           int
+	LastFound    string
+	TimeSince    string
+	Url          string
+	Descript     string
+	Title        string
+	SiteLink     string
+	Icon         string
+	ItemCount    int
+	MetaAge      string
+	Group        string
+	Groups       []string
+	Tags         []string
+	TagList      string
+	Effective    storage.EffectiveSettings
+	AppTarget    string
+	Overrides    feedSettingsValues
+	Paused       bool
+	PauseReason  string
+	Snoozed      bool
+	SnoozedUntil string
+	SnoozeEnds   int64
+	SnoozeLeft   string
+	Notice       string
+	// Path of the webhook below the config page. Blank unless the feed is a webhook feed.
+	Webhook      string
+	Signed       bool
+	Failures     int
+	LastError    string
+	LastErrorAge string
+	// Blank when never fetched.
+	LastSuccessAge string
+	Targets        []targetRow
+	TargetsOnly    bool
+}
+
+// A target of a feed with the outcome of its latest delivery.
+type targetRow struct {
+	storage.Target
+	Label string
+	// Header values are left out as they often hold secrets.
+	HeaderNames string
+	// Blank when nothing was delivered yet.
+	LastAge string
+}
+
+type feedTargetsData struct {
+	Id          int
+	Title       string
+	Targets     []targetRow
+	TargetsOnly bool
+	Methods     []string
+	Message     string
+	Error       string
+}
+
+type feedPreviewData struct {
+	Url         string
+	Title       string
+	Description string
+	FeedType    string
+	FeedVersion string
+	ItemCount   int
+	Items       []rssreader.PreviewItem
+	Sent        int
+	Summarized  int
+	Warnings    []string
+	// Values of the new feed form carried over to subscribing.
+	Form map[string]string
+}
+
+type feedCandidatesData struct {
+	Url        string
+	Candidates []rssreader.FeedCandidate
+	// Values of the new feed form other than the URL.
+	Form map[string]string
 }
 
-func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Reader, hookConfig *structs.Config, hostname string, logger *log.Logger, logBuffer *bytes.Buffer) {
+type feedItemsData struct {
+	Id      int
+	Title   string
+	Items   []deliveryRow
+	Message string
+	Error   string
+}
+
+type deliveryRow struct {
+	storage.Delivery
+	// Identifies the item in URLs.
+	Key         string
+	SeenAt      string
+	DeliveredAt string
+}
+
+type feedListData struct {
+	Query         feedListQuery
+	Total         int
+	Pages         int
+	Sections      []feedListSection
+	PreviousQuery string
+	NextQuery     string
+	Notice        string
+}
+
+// Feeds of a group on the current page of the feed list. The feeds without a group have no name.
+type feedListSection struct {
+	Name string
+	Ids  []int
+}
+
+type feedEditData struct {
+	Id          int
+	Title       string
+	FeedTitle   string
+	Url         string
+	DisplayName string
+	Webhook     *storage.WebhookSource
+	Error       string
+}
+
+// Form values of settings that can be inherited. Blank when inherited.
+type feedSettingsValues struct {
+	PollMinutes string
+	Priority    string
+	MaxItems    string
+	AppToken    string
+}
+
+type groupData struct {
+	Name     string
+	Settings feedSettingsValues
+}
+
+type groupsListData struct {
+	Groups  []groupData
+	Message string
+}
+
+type importReportData struct {
+	Total      int
+	Imported   []string
+	Duplicates []string
+	Invalid    []string
+	Error      string
+}
+
+type settingsFormData struct {
+	Settings storage.Settings
+	Message  string
+}
+
+func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Reader, hookConfig *structs.Config, hostname string, logger *slog.Logger, logRing *logging.Ring, broker *events.Broker) {
 	var cards = []card{}
 
 	var generalInfoCard = card{Body: template.HTML(generalInfoCardBody)}
 	cards = append(cards, generalInfoCard)
-	var loggerCard = card{Body: template.HTML(loggerCardBody)}
+	// The query of the page is passed on so that a bookmarked search is shown.
+	var feedsCard = card{Body: template.HTML("<span hx-get='feeds' hx-vals='js:...Object.fromEntries(new URLSearchParams(window.location.search))' hx-trigger='load' hx-target='closest div' hx-swap='outerHTML'></span>")}
+	newFeedCardRendered, newFeedCardError := renderPartial(newFeedCardBody, storage.WebhookSource{Mapping: storage.DefaultWebhookMapping()})
+	opmlCardRendered, opmlCardError := renderPartial(opmlCardBody, nil)
+	loggerCardRendered, loggerCardError := renderPartial(loggerCardBody, nil)
+	if newFeedCardError != nil || opmlCardError != nil || loggerCardError != nil {
+		logger.Error("Failed to parse Card Templates", "error", errors.Join(newFeedCardError, opmlCardError, loggerCardError))
+		return
+	}
+	var loggerCard = card{Body: loggerCardRendered}
 	cards = append(cards, loggerCard)
-	var feedsCard = card{Body: template.HTML("<span hx-get='feeds' hx-trigger='load' hx-target='closest div' hx-swap='outerHTML'></span>")}
-	var newFeedCard = card{Title: "Create Feed", Body: template.HTML(newFeedCardBody)}
+	var newFeedCard = card{Title: "Create Feed", Body: newFeedCardRendered}
+	var opmlCard = card{Body: opmlCardRendered}
+	var settingsCard = card{Body: template.HTML(settingsCardBody)}
+	var groupsCard = card{Body: template.HTML(groupsCardBody)}
+	var statsCard = card{Body: template.HTML(statsCardBody)}
 
-	var pageData = userPage{HtmxBasePath: "htmx.min.js", Cards: cards, MainJSPath: "main.js", Bootstrap: "bootstrap.min.css"}
+	var pageData = userPage{HtmxBasePath: "htmx.min.js", HtmxSSEPath: "sse.js", Cards: cards, MainJSPath: "main.js", Bootstrap: "bootstrap.min.css"}
 
 	wrapperTemplate, wrapperTemplateParseError := template.New("").Parse(wrapper)
 	if wrapperTemplateParseError != nil {
-		logger.Println("Failed to parse Wrapper Template")
-		logger.Println(wrapperTemplateParseError.Error())
+		logger.Error("Failed to parse Wrapper Template", "error", wrapperTemplateParseError)
 		return
 	}
 
-	feedCardTemplate, feedCardParseError := template.New("").Parse(feedCardBody)
+	feedCardTemplate, feedCardParseError := parseWithPartials(feedCardBody)
 	if feedCardParseError != nil {
-		logger.Println("Failed to parse Feed Card Template")
-		logger.Println(feedCardParseError.Error())
+		logger.Error("Failed to parse Feed Card Template", "error", feedCardParseError)
+		return
+	}
+
+	feedEditTemplate, feedEditParseError := parseWithPartials(feedEditCardBody)
+	if feedEditParseError != nil {
+		logger.Error("Failed to parse Feed Edit Template", "error", feedEditParseError)
+		return
+	}
+
+	feedPreviewTemplate, feedPreviewParseError := template.New("").Parse(feedPreviewBody)
+	if feedPreviewParseError != nil {
+		logger.Error("Failed to parse Feed Preview Template", "error", feedPreviewParseError)
+		return
+	}
+
+	feedCandidatesTemplate, feedCandidatesParseError := template.New("").Parse(feedCandidatesBody)
+	if feedCandidatesParseError != nil {
+		logger.Error("Failed to parse Feed Candidates Template", "error", feedCandidatesParseError)
+		return
+	}
+
+	feedTargetsTemplate, feedTargetsParseError := parseWithPartials(feedTargetsBody)
+	if feedTargetsParseError != nil {
+		logger.Error("Failed to parse Feed Targets Template", "error", feedTargetsParseError)
+		return
+	}
+
+	feedItemsTemplate, feedItemsParseError := template.New("").Parse(feedItemsBody)
+	if feedItemsParseError != nil {
+		logger.Error("Failed to parse Feed Items Template", "error", feedItemsParseError)
+		return
+	}
+
+	statsTemplate, statsParseError := template.New("").Parse(statsBody)
+	if statsParseError != nil {
+		logger.Error("Failed to parse Stats Template", "error", statsParseError)
+		return
+	}
+
+	logEntriesTemplate, logEntriesParseError := template.New("").Parse(logEntriesBody)
+	if logEntriesParseError != nil {
+		logger.Error("Failed to parse Log Entries Template", "error", logEntriesParseError)
+		return
+	}
+
+	feedLogsTemplate, feedLogsParseError := parseWithPartials(feedLogsBody)
+	if feedLogsParseError != nil {
+		logger.Error("Failed to parse Feed Logs Template", "error", feedLogsParseError)
+		return
+	}
+
+	bulkConfirmTemplate, bulkConfirmParseError := template.New("").Parse(bulkConfirmBody)
+	if bulkConfirmParseError != nil {
+		logger.Error("Failed to parse Bulk Confirm Template", "error", bulkConfirmParseError)
+		return
+	}
+
+	feedListTemplate, feedListParseError := template.New("").Parse(feedListBody)
+	if feedListParseError != nil {
+		logger.Error("Failed to parse Feed List Template", "error", feedListParseError)
+		return
+	}
+
+	settingsFormTemplate, settingsFormParseError := template.New("").Parse(settingsFormBody)
+	if settingsFormParseError != nil {
+		logger.Error("Failed to parse Settings Form Template", "error", settingsFormParseError)
+		return
+	}
+
+	groupsListTemplate, groupsListParseError := parseWithPartials(groupsListBody)
+	if groupsListParseError != nil {
+		logger.Error("Failed to parse Groups List Template", "error", groupsListParseError)
+		return
+	}
+
+	importReportTemplate, importReportParseError := template.New("").Parse(importReportBody)
+	if importReportParseError != nil {
+		logger.Error("Failed to parse Import Report Template", "error", importReportParseError)
 		return
 	}
 
 	cardWrapperTemplate, cardWrapperError := template.New("").Parse(blankCardWrapper)
 	if cardWrapperError != nil {
-		logger.Println("Failed to parse Blank Card Template")
-		logger.Println(cardWrapperError.Error())
+		logger.Error("Failed to parse Blank Card Template", "error", cardWrapperError)
 		return
 	}
 
 	mux.GET("/"+pageData.HtmxBasePath, func(ctx *gin.Context) {
 		ctx.Data(http.StatusOK, "text/javascript", []byte(htmxMinJS))
 	})
+	mux.GET("/"+pageData.HtmxSSEPath, func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "text/javascript", []byte(htmxSSEJS))
+	})
 	mux.GET("/"+pageData.MainJSPath, func(ctx *gin.Context) {
 		ctx.Data(http.StatusOK, "text/javascript", []byte(mainJS))
 	})
@@ -111,6 +424,8 @@ func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Re
 		ctx.Data(http.StatusOK, "text/css", []byte(bootstrap))
 	})
 
+	var eventsPath = mux.BasePath() + "/events"
+	var sessions = new(eventSessions)
 	mux.GET("/", func(ctx *gin.Context) {
 		var clientKey = ctx.Request.Header.Get("X-Gotify-Key")
 		if len(clientKey) == 0 {
@@ -119,59 +434,194 @@ func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Re
 			cards = append(cards, generalInfoCard)
 			cards = append(cards, feedsCard)
 			cards = append(cards, newFeedCard)
+			cards = append(cards, groupsCard)
+			cards = append(cards, opmlCard)
+			cards = append(cards, settingsCard)
+			cards = append(cards, statsCard)
 			cards = append(cards, loggerCard)
 			pageData.Cards = cards
 
 			err := wrapperTemplate.Execute(ctx.Writer, pageData)
 			if err != nil {
-				logger.Println(err)
+				logger.Error("Failed to render the config page", "error", err)
 			}
 			ctx.Done()
 		} else {
 			var server = rss.GetGotifyApi()
 			var failed = server.CheckToken(clientKey)
 			if failed != nil {
-				logger.Println(failed)
+				logger.Warn("Rejected token", "error", failed)
 				ctx.Data(http.StatusOK, "text/html", []byte("<h2>Unauthorized token. Redirecting to main page.</h2><script>window.location = '/';</script>"))
 				ctx.Done()
 				return
 			}
+			http.SetCookie(ctx.Writer, &http.Cookie{
+				Name:     eventSessionCookie,
+				Value:    sessions.start(clientKey, time.Now()),
+				Path:     eventsPath,
+				MaxAge:   int(eventSessionLifetime.Seconds()),
+				Secure:   ctx.Request.TLS != nil,
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
 			tmpl, err := template.New("").Parse(main)
 			if err != nil {
-				logger.Println(err)
+				logger.Error("Failed to render the config page", "error", err)
 				ctx.Done()
 				return
 			}
 			err = tmpl.Execute(ctx.Writer, pageData)
 			if err != nil {
-				logger.Println(err)
+				logger.Error("Failed to render the config page", "error", err)
 			}
 		}
 
 	})
 
+	// Webhook senders have no Gotify key. Registered before the middleware, they are checked against the token of the feed instead.
+	mux.POST("/hooks/:feedID/:token", func(ctx *gin.Context) {
+		id, err := strconv.Atoi(ctx.Param("feedID"))
+		if err != nil {
+			abortWithAPIError(ctx, http.StatusNotFound, storage.ErrFeedNotFound)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxWebhookBody))
+		if err != nil {
+			abortWithAPIError(ctx, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		summary, err := rss.ReceiveWebhook(id, ctx.Param("token"), ctx.Request.Header, body)
+		if err != nil {
+			abortWithAPIError(ctx, webhookErrorStatus(err), err)
+			return
+		}
+		ctx.JSON(http.StatusOK, apiPollSummaryOf(summary))
+	})
+
 	internalGotifyApi := gotify_api.SetupGotifyApi(hostname, "")
+	var apiBasePath = mux.BasePath() + apiPath
 	mux.Use(func(ctx *gin.Context) {
+		// The JSON API answers with JSON errors, the interface with plain text.
+		var reject = func(err error) {
+			if strings.HasPrefix(ctx.Request.URL.Path, apiBasePath+"/") {
+				abortWithAPIError(ctx, http.StatusUnauthorized, err)
+				return
+			}
+			ctx.Data(http.StatusUnauthorized, "text/html", []byte(err.Error()))
+			ctx.Abort()
+		}
+
 		var clientKey = ctx.Request.Header.Get("X-Gotify-Key")
+		// An EventSource cannot send headers so the event stream takes the key of the session the page started.
+		if len(clientKey) == 0 && ctx.Request.URL.Path == eventsPath {
+			if id, err := ctx.Cookie(eventSessionCookie); err == nil {
+				clientKey, _ = sessions.clientKey(id, time.Now())
+			}
+		}
 		if len(clientKey) == 0 {
-			ctx.Data(http.StatusUnauthorized, "text/html", []byte("X-Gotify-Key Missing"))
-			ctx.Done()
+			reject(errors.New("X-Gotify-Key Missing"))
 			return
 		}
 
 		var failed = internalGotifyApi.UpdateToken(clientKey)
 		if failed != nil {
-			logger.Println(failed)
-			ctx.Data(http.StatusUnauthorized, "application/json", []byte(failed.Error()))
-			ctx.Done()
+			logger.Warn("Rejected token", "error", failed)
+			reject(failed)
 			return
 		}
 		ctx.Set("token", clientKey)
 		ctx.Next()
 	})
 
+	var feedName = func(id int) string {
+		if feed := rss.Storage.GetFeedByID(id); feed != nil {
+			return feed.Name()
+		}
+		return fmt.Sprintf("Deleted feed #%d", id)
+	}
+
 	mux.GET("/logs", func(ctx *gin.Context) {
-		ctx.Data(http.StatusOK, "text/html", logBuffer.Bytes())
+		var data = logEntriesData{MaxRows: logRing.Size()}
+		filter, err := logFilterFrom(ctx.Request.URL.Query(), time.Now())
+		if err != nil {
+			data.Error = err.Error()
+		} else {
+			data.SingleFeed = filter.FeedID != nil
+			data.Rows = logRows(logRing.Entries(filter), feedName)
+		}
+		var finalHTML = new(bytes.Buffer)
+		logEntriesTemplate.Execute(finalHTML, data)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	mux.GET("/stats", func(ctx *gin.Context) {
+		var finalHTML = new(bytes.Buffer)
+		statsTemplate.Execute(finalHTML, buildStatsData(rss.Storage, time.Now()))
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	// Live updates of the config page. See liveMessages for what is sent.
+	mux.GET("/events", func(ctx *gin.Context) {
+		subscription, unsubscribe := broker.Subscribe()
+		defer unsubscribe()
+		var keepAlive = time.NewTicker(keepAliveInterval)
+		defer keepAlive.Stop()
+		var renderCard = func(id int) (string, bool) {
+			var feed = rss.Storage.GetFeedByID(id)
+			if feed == nil {
+				return "", false
+			}
+			var finalHTML = new(bytes.Buffer)
+			if err := feedCardTemplate.Execute(finalHTML, buildFeedCardData(rss, id, feed)); err != nil {
+				return "", false
+			}
+			return finalHTML.String(), true
+		}
+		var renderLogRow = func(entry logging.Entry) string {
+			var finalHTML = new(bytes.Buffer)
+			logEntriesTemplate.ExecuteTemplate(finalHTML, "log-row", logRows([]logging.Entry{entry}, feedName)[0])
+			return finalHTML.String()
+		}
+
+		ctx.Header("Content-Type", "text/event-stream")
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("X-Accel-Buffering", "no")
+		// Sends the headers right away so the page knows it is connected.
+		io.WriteString(ctx.Writer, ": connected\n\n")
+		ctx.Writer.Flush()
+		ctx.Stream(func(writer io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case <-keepAlive.C:
+				io.WriteString(writer, ": keep-alive\n\n")
+				return true
+			case event, open := <-subscription:
+				if !open {
+					return false
+				}
+				for _, message := range liveMessages(event, renderCard, renderLogRow) {
+					ctx.SSEvent(message.Name, message.Data)
+				}
+				return true
+			}
+		})
+	})
+
+	// Options of the feed filter of the log view.
+	mux.GET("/logs/feeds", func(ctx *gin.Context) {
+		var options = new(bytes.Buffer)
+		options.WriteString(`<option value="">All feeds</option>`)
+		var feeds = rss.Storage.GetFeeds()
+		var ids = make([]int, 0, len(feeds))
+		for id := range feeds {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		for _, id := range ids {
+			fmt.Fprintf(options, `<option value="%d">%s</option>`, id, template.HTMLEscapeString(feeds[id].Name()))
+		}
+		ctx.Data(http.StatusOK, "text/html", options.Bytes())
 	})
 
 	mux.GET("/getLoginToken", func(ctx *gin.Context) {
@@ -195,10 +645,9 @@ func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Re
 
 	})
 
-	mux.PUT("/defaultToken", func(ctx *gin.Context) {
-		var headerToken = ctx.GetString("token")
-		var token = ctx.PostForm("token")
-
+	// Sets the client token the plugin uses. "new" creates a client of its own, replacing the one created before
+	// unless it is the client of the request.
+	var updateDefaultToken = func(headerToken string, token string) error {
 		if token == "new" {
 			currentToken := rss.Storage.GetClientToken()
 			if internalGotifyApi.CheckToken(currentToken) == nil {
@@ -209,44 +658,316 @@ func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Re
 			}
 			newClient, err := internalGotifyApi.CreateClient("RSS Client")
 			if err != nil {
-				logger.Println(err)
-				ctx.Redirect(303, "defaultToken")
-				return
+				return err
 			}
 			token = newClient.Token
 		}
+		return rss.UpdateToken(token)
+	}
 
-		rss.UpdateToken(token)
+	buildAPI(mux.Group(apiPath), rss, logger, logRing, updateDefaultToken)
+
+	mux.PUT("/defaultToken", func(ctx *gin.Context) {
+		var err = updateDefaultToken(ctx.GetString("token"), ctx.PostForm("token"))
+		if err != nil {
+			logger.Error("Failed to update token", "error", err)
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)+`<div hx-get="defaultToken" hx-trigger="load" hx-target="this" hx-swap="outerHTML"></div>`))
+			return
+		}
 
 		ctx.Redirect(303, "defaultToken")
 	})
 
+	mux.GET("/storageStatus", func(ctx *gin.Context) {
+		var err = rss.Storage.Error()
+		if err == nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(""))
+			return
+		}
+		ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+	})
+
+	mux.GET("/settings", func(ctx *gin.Context) {
+		var finalHTML = new(bytes.Buffer)
+		settingsFormTemplate.Execute(finalHTML, settingsFormData{Settings: rss.Storage.GetSettings()})
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	mux.PUT("/settings", func(ctx *gin.Context) {
+		var finalHTML = new(bytes.Buffer)
+		var settings = rss.Storage.GetSettings()
+		var formData = settingsFormData{Settings: settings, Message: "Saved"}
+		var fields = map[string]*int{
+			"rate-limit":        &settings.RateLimitPerMinute,
+			"max-items":         &settings.MaxItemsPerPoll,
+			"breaker-percent":   &settings.BreakerPercent,
+			"breaker-min-items": &settings.BreakerMinItems,
+			"poll-minutes":      &settings.PollMinutes,
+			"priority":          &settings.Priority,
+		}
+		for field, value := range fields {
+			number, err := strconv.Atoi(ctx.PostForm(field))
+			if err != nil || number < 0 || (field == "poll-minutes" && number < 1) {
+				formData.Message = fmt.Sprintf("Invalid value for %s: %q", field, ctx.PostForm(field))
+				settingsFormTemplate.Execute(finalHTML, formData)
+				ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+				return
+			}
+			*value = number
+		}
+		settings.AppToken = strings.TrimSpace(ctx.PostForm("app-token"))
+
+		var err = rss.Storage.SaveSettings(settings)
+		if err != nil {
+			formData.Message = err.Error()
+		}
+		formData.Settings = settings
+		settingsFormTemplate.Execute(finalHTML, formData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	var renderFeedList = func(ctx *gin.Context, query feedListQuery, notice string) {
+		var allFeeds = rss.Storage.GetFeeds()
+		ids, total := query.apply(allFeeds, time.Now())
+
+		var listData = feedListData{Query: query, Total: total, Pages: pageCount(total), Notice: notice}
+		listData.PreviousQuery = query.WithPage(query.Page - 1).Encode()
+		listData.NextQuery = query.WithPage(query.Page + 1).Encode()
+
+		var byGroup = map[string][]int{}
+		for _, id := range ids {
+			byGroup[allFeeds[id].Group] = append(byGroup[allFeeds[id].Group], id)
+		}
+		if len(byGroup[""]) != 0 {
+			listData.Sections = append(listData.Sections, feedListSection{Ids: byGroup[""]})
+		}
+		for _, name := range sortedGroupNames(rss.Storage.GetGroups()) {
+			if len(byGroup[name]) != 0 {
+				listData.Sections = append(listData.Sections, feedListSection{Name: name, Ids: byGroup[name]})
+			}
+		}
+
+		// Keeps the address of the page in step with the list so that it can be bookmarked.
+		ctx.Header("HX-Replace-Url", "?"+query.Encode())
+		var finalHTML = new(bytes.Buffer)
+		feedListTemplate.Execute(finalHTML, listData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	}
+
 	mux.GET("/feeds", func(ctx *gin.Context) {
-		var feeds = ""
-		for id, _ := range *rss.Storage.GetFeeds() {
-			feeds += fmt.Sprintf("<div hx-swap='outerHTML' hx-get='feed/%d' hx-trigger='load'></div>", id)
+		renderFeedList(ctx, feedListQueryFrom(ctx.Request.URL.Query()), "")
+	})
+
+	// Bulk actions on the feeds selected in the feed list. Deleting and replacing first show what will change
+	// and are only applied once confirmed.
+	var renderBulkConfirm = func(ctx *gin.Context, data bulkConfirmData) {
+		var finalHTML = new(bytes.Buffer)
+		bulkConfirmTemplate.Execute(finalHTML, data)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	}
+
+	mux.POST("/bulk/delete", func(ctx *gin.Context) {
+		ids, err := selectedFeedIDs(ctx)
+		if err != nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
 		}
-		ctx.Data(http.StatusOK, "text/html", []byte(feeds))
+		if ctx.PostForm("confirm") != "true" {
+			var data = bulkConfirmData{Action: "delete", Ids: ids, Query: feedListQueryFrom(ctx.Request.PostForm)}
+			var feeds = rss.Storage.GetFeeds()
+			for _, id := range ids {
+				if feeds[id] != nil {
+					data.Changes = append(data.Changes, rssreader.UrlChange{ID: id, Name: feeds[id].Name(), From: feeds[id].Url})
+				}
+			}
+			renderBulkConfirm(ctx, data)
+			return
+		}
+		if err := rss.Storage.RemoveFeedsByID(ids); err != nil {
+			logger.Error("Failed to delete feeds", "error", err)
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		renderFeedList(ctx, feedListQueryFrom(ctx.Request.PostForm), fmt.Sprintf("Deleted %d feeds.", len(ids)))
 	})
 
-	mux.POST("/create-feed", func(ctx *gin.Context) {
-		var feedUrl = ctx.PostForm("feed-url")
+	mux.POST("/bulk/replace", func(ctx *gin.Context) {
+		ids, err := selectedFeedIDs(ctx)
+		if err != nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		var find, replace = ctx.PostForm("find"), ctx.PostForm("replace")
+		if ctx.PostForm("confirm") != "true" {
+			changes, err := rss.PlanUrlReplace(ids, find, replace)
+			if err != nil {
+				ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+				return
+			}
+			renderBulkConfirm(ctx, bulkConfirmData{Action: "replace", Ids: ids, Find: find, Replace: replace, Changes: changes,
+				Unchanged: len(ids) - len(changes), Query: feedListQueryFrom(ctx.Request.PostForm)})
+			return
+		}
+		changes, err := rss.ReplaceFeedUrls(ids, find, replace)
+		if err != nil {
+			logger.Error("Failed to replace feed URLs", "error", err)
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		renderFeedList(ctx, feedListQueryFrom(ctx.Request.PostForm), fmt.Sprintf("Changed the URL of %d feeds.", len(changes)))
+	})
+
+	mux.POST("/bulk/check", func(ctx *gin.Context) {
+		ids, err := selectedFeedIDs(ctx)
+		if err != nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		renderFeedList(ctx, feedListQueryFrom(ctx.Request.PostForm), rss.CheckFeedIDs(ids).String())
+	})
+
+	mux.POST("/check", func(ctx *gin.Context) {
+		var summary = rss.CheckAllNow()
+		ctx.Data(http.StatusOK, "text/html", []byte(summaryAlert(summary)))
+	})
 
+	var renderGroups = func(ctx *gin.Context, message string) {
+		var groups = rss.Storage.GetGroups()
+		var listData = groupsListData{Message: message}
+		for _, name := range sortedGroupNames(groups) {
+			listData.Groups = append(listData.Groups, groupData{Name: name, Settings: settingsValues(groups[name].Settings)})
+		}
 		var finalHTML = new(bytes.Buffer)
-		feedData, feedError := gofeed.NewParser().ParseURL(feedUrl)
-		if feedError == nil && feedData != nil {
-			var feed = rss.Storage.SaveNewFeed(feedUrl)
-			var id = feed.GetID()
+		groupsListTemplate.Execute(finalHTML, listData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	}
 
-			var cardData = feedCardData{Id: id, Url: feed.Url, Descript: feedData.Description, Title: feedData.Title}
+	mux.GET("/groups", func(ctx *gin.Context) {
+		renderGroups(ctx, "")
+	})
 
-			if feed.LastDate != nil {
-				cardData.LastFound = feed.LastDate.Round(time.Second).String()
-				cardData.TimeSince = time.Since(*feed.LastDate).Round(time.Second).String()
+	mux.POST("/groups", func(ctx *gin.Context) {
+		var group = storage.Group{Name: strings.TrimSpace(ctx.PostForm("group-name"))}
+		// Only the forms of existing groups have the settings fields.
+		_, editing := ctx.GetPostForm("poll-minutes")
+		if !editing && rss.Storage.GetGroups()[group.Name] != nil {
+			renderGroups(ctx, fmt.Sprintf("A group named %q already exists", group.Name))
+			return
+		}
+		if editing {
+			settings, err := feedSettingsFromForm(ctx)
+			if err != nil {
+				renderGroups(ctx, err.Error())
+				return
 			}
-			feedCardTemplate.Execute(finalHTML, cardData)
-		} else {
-			logger.Printf("Failed to add: %s", feedUrl)
+			group.Settings = settings
+		}
+		var err = rss.Storage.SaveGroup(group)
+		if err != nil {
+			logger.Error("Failed to save group", "group", group.Name, "error", err)
+			renderGroups(ctx, err.Error())
+			return
+		}
+		renderGroups(ctx, "")
+	})
+
+	mux.DELETE("/groups", func(ctx *gin.Context) {
+		var err = rss.Storage.RemoveGroup(ctx.Query("group-name"))
+		if err != nil {
+			renderGroups(ctx, err.Error())
+			return
+		}
+		renderGroups(ctx, "")
+	})
+
+	mux.GET("/new-feed", func(ctx *gin.Context) {
+		var finalHTML = new(bytes.Buffer)
+		cardWrapperTemplate.Execute(finalHTML, newFeedCard)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	mux.POST("/preview-feed", func(ctx *gin.Context) {
+		var feedUrl = strings.TrimSpace(ctx.PostForm("feed-url"))
+
+		var finalHTML = new(bytes.Buffer)
+		var showError = func(err error) {
+			finalHTML.WriteString(errorAlert(err))
+			cardWrapperTemplate.Execute(finalHTML, newFeedCard)
+			ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+		}
+		backlog, backlogError := backlogFromForm(ctx)
+		maxItems, maxItemsError := optionalIntFromForm(ctx, "max-items")
+		if err := errors.Join(rssreader.ValidateURL(feedUrl), backlogError, maxItemsError); err != nil {
+			showError(err)
+			return
+		}
+		var form = map[string]string{}
+		for _, field := range []string{"backlog-mode", "backlog-count", "backlog-since", "max-items"} {
+			form[field] = ctx.PostForm(field)
+		}
+
+		feed, err := rssreader.FetchFeed(feedUrl)
+		if err != nil {
+			// Likely the address of a web page rather than of its feed.
+			candidates, discoverError := rssreader.DiscoverFeeds(feedUrl)
+			if discoverError != nil || len(candidates) == 0 {
+				logger.Warn("No feed found", "url", feedUrl, "error", errors.Join(err, discoverError))
+				showError(fmt.Errorf("no feed found at %s or linked from it: %w", feedUrl, err))
+				return
+			}
+			feedCandidatesTemplate.Execute(finalHTML, feedCandidatesData{Url: feedUrl, Candidates: candidates, Form: form})
+			ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+			return
+		}
+
+		var limit = rss.Storage.GetSettings().MaxItemsPerPoll
+		if maxItems != nil {
+			limit = *maxItems
+		}
+		var preview = rssreader.PreviewFeed(feed, backlog, limit)
+		var previewData = feedPreviewData{
+			Url:         feedUrl,
+			Title:       feed.Title,
+			Description: feed.Description,
+			FeedType:    feed.FeedType,
+			FeedVersion: feed.FeedVersion,
+			ItemCount:   len(feed.Items),
+			Items:       preview.Items,
+			Sent:        preview.Sent,
+			Summarized:  preview.Summarized,
+			Warnings:    preview.Warnings,
+			Form:        form,
+		}
+		previewData.Form["feed-url"] = feedUrl
+		if len(previewData.Title) == 0 {
+			previewData.Title = feedUrl
+		}
+		feedPreviewTemplate.Execute(finalHTML, previewData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	mux.POST("/create-feed", func(ctx *gin.Context) {
+		var feedUrl = ctx.PostForm("feed-url")
+
+		var finalHTML = new(bytes.Buffer)
+		backlog, backlogError := backlogFromForm(ctx)
+		maxItems, maxItemsError := optionalIntFromForm(ctx, "max-items")
+		if backlogError != nil || maxItemsError != nil {
+			var err = errors.Join(backlogError, maxItemsError)
+			logger.Error("Failed to add feed", "url", feedUrl, "error", err)
+			finalHTML.WriteString(errorAlert(err))
+			cardWrapperTemplate.Execute(finalHTML, newFeedCard)
+			ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+			return
+		}
+
+		feed, err := rss.AddFeed(feedUrl, rssreader.NewFeed{Backlog: backlog, Settings: storage.FeedSettings{MaxItemsPerPoll: maxItems}})
+		if feed != nil {
+			feedCardTemplate.Execute(finalHTML, buildFeedCardData(rss, feed.GetID(), feed))
+		}
+		if err != nil {
+			logger.Error("Failed to add feed", "url", feedUrl, "error", err)
+			finalHTML.WriteString(errorAlert(err))
 		}
 
 		cardWrapperTemplate.Execute(finalHTML, newFeedCard)
@@ -254,14 +975,169 @@ func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Re
 		ctx.Data(http.StatusOK, "text/html", []byte(finalHTML.String()))
 	})
 
+	mux.POST("/create-webhook-feed", func(ctx *gin.Context) {
+		var name = strings.TrimSpace(ctx.PostForm("webhook-name"))
+
+		var finalHTML = new(bytes.Buffer)
+		source, err := webhookSourceFromForm(ctx)
+		var feed *storage.Feed
+		if err == nil {
+			feed, err = rss.AddWebhookFeed(name, *source, storage.FeedSettings{})
+		}
+		if feed != nil {
+			feedCardTemplate.Execute(finalHTML, buildFeedCardData(rss, feed.GetID(), feed))
+		}
+		if err != nil {
+			logger.Error("Failed to add webhook feed", "name", name, "error", err)
+			finalHTML.WriteString(errorAlert(err))
+		}
+
+		cardWrapperTemplate.Execute(finalHTML, newFeedCard)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	mux.GET("/opml", func(ctx *gin.Context) {
+		var subscriptions = []opml.Subscription{}
+		var feeds = rss.Storage.GetFeeds()
+		// Only the given feeds when exporting a selection.
+		if selected := ctx.QueryArray("feed"); len(selected) != 0 {
+			var selection = map[int]*storage.Feed{}
+			for _, value := range selected {
+				if id, err := strconv.Atoi(value); err == nil && feeds[id] != nil {
+					selection[id] = feeds[id]
+				}
+			}
+			feeds = selection
+		}
+		for _, id := range sortedFeedIDs(feeds) {
+			// Webhook feeds have no URL to subscribe to.
+			if feeds[id].Webhook != nil {
+				continue
+			}
+			subscriptions = append(subscriptions, opml.Subscription{Url: feeds[id].Url, Title: feedExportTitle(feeds[id]), SiteUrl: feeds[id].Meta.SiteLink, Group: feeds[id].Group, Tags: feeds[id].Tags})
+		}
+		document, err := opml.Encode("Simple Feeds", subscriptions)
+		if err != nil {
+			logger.Error("Failed to export OPML", "error", err)
+			ctx.Data(http.StatusInternalServerError, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		ctx.Header("Content-Disposition", `attachment; filename="simple-feeds.opml"`)
+		ctx.Data(http.StatusOK, "text/x-opml", document)
+	})
+
+	mux.POST("/opml", func(ctx *gin.Context) {
+		var finalHTML = new(bytes.Buffer)
+		var report = importReportData{}
+		var respond = func(err error) {
+			if err != nil {
+				report.Error = err.Error()
+			}
+			importReportTemplate.Execute(finalHTML, report)
+			ctx.Data(uploadErrorStatus(err), "text/html", finalHTML.Bytes())
+		}
+
+		// Read first as it also reads the rest of the form.
+		document, err := uploadedFile(ctx, "opml-file")
+		if err != nil {
+			respond(err)
+			return
+		}
+		backlog, err := backlogFromForm(ctx)
+		if err != nil {
+			respond(err)
+			return
+		}
+		subscriptions, err := opml.Decode(document)
+		if err != nil {
+			respond(fmt.Errorf("failed to read OPML file: %w", err))
+			return
+		}
+
+		report.Total = len(subscriptions)
+		var known = map[string]bool{}
+		for _, feed := range rss.Storage.GetFeeds() {
+			known[feed.Url] = true
+		}
+		var groups = rss.Storage.GetGroups()
+		var ids = []int{}
+		for _, subscription := range subscriptions {
+			if err := rssreader.ValidateURL(subscription.Url); err != nil {
+				report.Invalid = append(report.Invalid, err.Error())
+				continue
+			}
+			if known[subscription.Url] {
+				report.Duplicates = append(report.Duplicates, subscription.Url)
+				continue
+			}
+			known[subscription.Url] = true
+
+			var feedBacklog = backlog
+			feed, err := rss.Storage.SaveNewFeed(subscription.Url, storage.FeedMeta{Title: subscription.Title, SiteLink: subscription.SiteUrl}, &feedBacklog)
+			if feed == nil {
+				respond(err)
+				return
+			}
+			subscription.Group = strings.TrimSpace(subscription.Group)
+			if len(subscription.Group) != 0 && groups[subscription.Group] == nil {
+				err = errors.Join(err, rss.Storage.SaveGroup(storage.Group{Name: subscription.Group}))
+				groups[subscription.Group] = &storage.Group{Name: subscription.Group}
+			}
+			if len(subscription.Group) != 0 || len(subscription.Tags) != 0 {
+				err = errors.Join(err, rss.Storage.SaveFeedGroupAndTags(feed.GetID(), subscription.Group, subscription.Tags))
+			}
+			ids = append(ids, feed.GetID())
+			report.Imported = append(report.Imported, subscription.Url)
+			if err != nil {
+				report.Error = err.Error()
+			}
+		}
+		logger.Info("Imported feeds from OPML", "imported", len(report.Imported), "total", report.Total)
+
+		// Applying the backlog fetches every feed so is left to run after responding.
+		rss.CheckFeedIDsInBackground(ids)
+		respond(nil)
+	})
+
+	mux.GET("/backup", func(ctx *gin.Context) {
+		backup, err := rss.Storage.Export()
+		if err != nil {
+			logger.Error("Failed to export backup", "error", err)
+			ctx.Data(http.StatusInternalServerError, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		ctx.Header("Content-Disposition", `attachment; filename="simple-feeds-backup.json"`)
+		ctx.Data(http.StatusOK, "application/json", backup)
+	})
+
+	mux.POST("/backup", func(ctx *gin.Context) {
+		backup, err := uploadedFile(ctx, "backup-file")
+		if err != nil {
+			ctx.Data(uploadErrorStatus(err), "text/html", []byte(errorAlert(err)))
+			return
+		}
+		var replace = ctx.PostForm("import-mode") == "replace"
+		summary, err := rss.Import(backup, replace)
+		var result = fmt.Sprintf(`<div class="mt-3">Restored backup: %d feeds added, %d updated, %d removed.</div>`, summary.Added, summary.Updated, summary.Removed)
+		if err != nil {
+			logger.Error("Failed to restore backup", "error", err)
+			result = errorAlert(err)
+			var saveError storage.SaveError
+			if errors.As(err, &saveError) {
+				result += fmt.Sprintf(`<div>Restored backup in memory: %d feeds added, %d updated, %d removed.</div>`, summary.Added, summary.Updated, summary.Removed)
+			}
+		}
+		ctx.Data(http.StatusOK, "text/html", []byte(result))
+	})
+
 	feedsGroup := mux.Group("/feed/:feedID", func(ctx *gin.Context) {
-		var feeds = *rss.Storage.GetFeeds()
 		var id = ctx.Param("feedID")
 		var intId, _ = strconv.Atoi(id)
 
-		var feed = feeds[intId]
+		var feed = rss.Storage.GetFeedByID(intId)
 		if feed == nil {
 			ctx.Data(http.StatusNotFound, "text/html", []byte("Invalid ID"))
+			ctx.Abort()
 			return
 		}
 
@@ -271,29 +1147,637 @@ func BuildInterface(basePath string, mux *gin.RouterGroup, rss *rssreader.RSS_Re
 
 	feedsGroup.GET("/", func(ctx *gin.Context) {
 		var id = ctx.GetInt("ID")
-		var feed = (*rss.Storage.GetFeeds())[id]
+		var feed = rss.Storage.GetFeedByID(id)
+
+		var finalHTML = new(bytes.Buffer)
+		feedCardTemplate.Execute(finalHTML, buildFeedCardData(rss, id, feed))
+
+		ctx.Data(http.StatusOK, "text/html", []byte(finalHTML.String()))
+	})
+
+	var renderItems = func(ctx *gin.Context, message string, err error) {
+		var id = ctx.GetInt("ID")
+		var itemsData = feedItemsData{Id: id, Title: rss.Storage.GetFeedByID(id).Name(), Message: message}
+		if err != nil {
+			itemsData.Error = err.Error()
+		}
+		var deliveries = rss.Storage.GetDeliveries(id)
+		for index := len(deliveries) - 1; index >= 0; index-- {
+			var row = deliveryRow{Delivery: deliveries[index], Key: base64.RawURLEncoding.EncodeToString([]byte(deliveries[index].ItemID))}
+			row.SeenAt = deliveries[index].SeenAt.Local().Format("2006-01-02 15:04")
+			if deliveries[index].DeliveredAt != nil {
+				row.DeliveredAt = deliveries[index].DeliveredAt.Local().Format("2006-01-02 15:04")
+			}
+			itemsData.Items = append(itemsData.Items, row)
+		}
+		var finalHTML = new(bytes.Buffer)
+		feedItemsTemplate.Execute(finalHTML, itemsData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	}
+
+	// Finds the latest delivery of the item named in the URL.
+	var findDelivery = func(ctx *gin.Context) (storage.Delivery, error) {
+		itemID, err := base64.RawURLEncoding.DecodeString(ctx.Param("item"))
+		if err != nil {
+			return storage.Delivery{}, errors.New("invalid item")
+		}
+		var deliveries = rss.Storage.GetDeliveries(ctx.GetInt("ID"))
+		for index := len(deliveries) - 1; index >= 0; index-- {
+			if deliveries[index].ItemID == string(itemID) {
+				return deliveries[index], nil
+			}
+		}
+		return storage.Delivery{}, errors.New("the item is no longer in the delivery log")
+	}
+
+	feedsGroup.GET("/logs", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var finalHTML = new(bytes.Buffer)
+		feedLogsTemplate.Execute(finalHTML, feedItemsData{Id: id, Title: rss.Storage.GetFeedByID(id).Name()})
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	feedsGroup.GET("/items", func(ctx *gin.Context) {
+		renderItems(ctx, "", nil)
+	})
+
+	feedsGroup.POST("/items/:item/resend", func(ctx *gin.Context) {
+		delivery, err := findDelivery(ctx)
+		if err == nil {
+			err = rss.Resend(ctx.GetInt("ID"), delivery)
+		}
+		if err != nil {
+			logger.Warn("Failed to resend item", logging.Feed(ctx.GetInt("ID")), "link", delivery.Link, "error", err)
+			renderItems(ctx, "", err)
+			return
+		}
+		renderItems(ctx, "Resent "+delivery.Title, nil)
+	})
+
+	feedsGroup.POST("/items/:item/unseen", func(ctx *gin.Context) {
+		var feed = rss.Storage.GetFeedByID(ctx.GetInt("ID"))
+		delivery, err := findDelivery(ctx)
+		if err == nil {
+			err = rss.Storage.MarkItemUnseen(ctx.GetInt("ID"), feed.SeenKey(delivery.ItemID, delivery.Link))
+		}
+		if err != nil {
+			renderItems(ctx, "", err)
+			return
+		}
+		if feed.Webhook != nil {
+			renderItems(ctx, delivery.Title+" will be sent again when it is next pushed to the webhook", nil)
+			return
+		}
+		renderItems(ctx, delivery.Title+" will be sent again on the next poll of the feed if it is still in the feed", nil)
+	})
 
+	var renderTargets = func(ctx *gin.Context, message string, err error) {
+		var id = ctx.GetInt("ID")
+		var feed = rss.Storage.GetFeedByID(id)
+		var targetsData = feedTargetsData{Id: id, Title: feed.Name(), Targets: targetRows(feed.Targets), TargetsOnly: feed.TargetsOnly, Methods: rssreader.TargetMethods, Message: message}
+		if err != nil {
+			targetsData.Error = err.Error()
+		}
 		var finalHTML = new(bytes.Buffer)
-		feedData, _ := gofeed.NewParser().ParseURL(feed.Url)
-		var cardData feedCardData
-		if feedData != nil {
-			cardData = feedCardData{Id: id, Url: feed.Url, Descript: feedData.Description, Title: feedData.Title}
+		feedTargetsTemplate.Execute(finalHTML, targetsData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	}
+
+	feedsGroup.GET("/targets", func(ctx *gin.Context) {
+		renderTargets(ctx, "", nil)
+	})
+
+	feedsGroup.POST("/targets", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var feed = rss.Storage.GetFeedByID(id)
+		headers, err := headersFromForm(ctx.PostForm("target-headers"))
+		if err != nil {
+			renderTargets(ctx, "", err)
+			return
+		}
+		target, err := rssreader.NewTarget(ctx.PostForm("target-name"), strings.TrimSpace(ctx.PostForm("target-url")), ctx.PostForm("target-method"), headers, ctx.PostForm("target-body"))
+		if err == nil {
+			err = rss.Storage.SaveFeedTargets(id, append(feed.Targets, target), feed.TargetsOnly)
+		}
+		if err != nil {
+			renderTargets(ctx, "", err)
+			return
+		}
+		renderTargets(ctx, "Added "+target.Label(), nil)
+	})
+
+	feedsGroup.PUT("/targets", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var err = rss.Storage.SaveFeedTargets(id, rss.Storage.GetFeedByID(id).Targets, ctx.PostForm("targets-only") == "true")
+		if err != nil {
+			renderTargets(ctx, "", err)
+			return
+		}
+		renderTargets(ctx, "Saved", nil)
+	})
+
+	feedsGroup.DELETE("/targets/:target", func(ctx *gin.Context) {
+		target, err := rss.RemoveTarget(ctx.GetInt("ID"), ctx.Param("target"))
+		if err != nil {
+			renderTargets(ctx, "", err)
+			return
+		}
+		renderTargets(ctx, "Removed "+target.Label(), nil)
+	})
+
+	feedsGroup.GET("/edit", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var feed = rss.Storage.GetFeedByID(id)
+
+		var finalHTML = new(bytes.Buffer)
+		feedEditTemplate.Execute(finalHTML, feedEditData{Id: id, Title: feed.Name(), FeedTitle: feed.Meta.Title, Url: feed.Url, DisplayName: feed.DisplayName, Webhook: feed.Webhook})
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	feedsGroup.PUT("/", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var feed = rss.Storage.GetFeedByID(id)
+		var feedUrl = strings.TrimSpace(ctx.PostForm("feed-url"))
+		var displayName = strings.TrimSpace(ctx.PostForm("display-name"))
+
+		var finalHTML = new(bytes.Buffer)
+		var edit = storage.FeedEdit{KeepHistory: true}
+		var err error
+		var source = feed.Webhook
+		if feed.Webhook != nil {
+			source, err = webhookSourceFromForm(ctx)
+			if err == nil {
+				source.Token = feed.Webhook.Token
+				if ctx.PostForm("new-token") == "true" {
+					source.Token = rssreader.NewWebhookToken()
+				}
+				edit.Webhook = source
+			}
 		} else {
-			cardData = feedCardData{Id: id, Url: feed.Url, Title: "Invalid URL"}
+			edit, err = rss.FeedUrlEdit(id, feedUrl)
+		}
+		if err == nil {
+			// The URL or webhook and the name are saved together so that a poll never sees one without the other.
+			edit.DisplayName = &displayName
+			err = rss.Storage.EditFeed(id, edit)
+		}
+		if err != nil {
+			logger.Error("Failed to edit feed", logging.Feed(id), "error", err)
+			feedEditTemplate.Execute(finalHTML, feedEditData{Id: id, Title: feed.Name(), FeedTitle: feed.Meta.Title, Url: feedUrl, DisplayName: displayName, Webhook: source, Error: err.Error()})
+			ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+			return
 		}
 
-		if feed.LastDate != nil {
-			cardData.LastFound = feed.LastDate.Round(time.Second).String()
-			cardData.TimeSince = time.Since(*feed.LastDate).Round(time.Second).String()
+		var cardData = buildFeedCardData(rss, id, rss.Storage.GetFeedByID(id))
+		if !edit.KeepHistory {
+			cardData.Notice = "The new URL serves a different feed. The items it holds now will be marked as seen on the next poll instead of being sent."
 		}
 		feedCardTemplate.Execute(finalHTML, cardData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
 
-		ctx.Data(http.StatusOK, "text/html", []byte(finalHTML.String()))
+	feedsGroup.PUT("/settings", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		settings, err := feedSettingsFromForm(ctx)
+		if err == nil {
+			var group = ctx.PostForm("group")
+			var tags = storage.ParseTags(ctx.PostForm("tags"))
+			err = rss.Storage.EditFeed(id, storage.FeedEdit{Settings: &settings, Group: &group, Tags: &tags})
+		}
+		if err != nil {
+			logger.Error("Failed to save feed settings", logging.Feed(id), "error", err)
+			ctx.Data(editErrorStatus(err), "text/html", []byte(errorAlert(err)))
+			return
+		}
+		ctx.Redirect(303, "../"+strconv.Itoa(id))
+	})
+
+	feedsGroup.POST("/refresh", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var err = rss.RefreshMeta(id)
+		if err != nil {
+			logger.Error("Failed to refresh metadata", logging.Feed(id), "error", err)
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		ctx.Redirect(303, "../"+strconv.Itoa(id))
+	})
+
+	feedsGroup.POST("/check", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var summary = rss.CheckFeed(id)
+		var cardData = buildFeedCardData(rss, id, rss.Storage.GetFeedByID(id))
+		cardData.Notice = summary.String()
+		if len(summary.Errors) != 0 {
+			cardData.Notice += " " + strings.Join(summary.Errors, " ")
+		}
+
+		var finalHTML = new(bytes.Buffer)
+		feedCardTemplate.Execute(finalHTML, cardData)
+		ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+	})
+
+	feedsGroup.POST("/pause", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var err = rss.Storage.PauseFeed(id, "paused manually")
+		if err != nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		ctx.Redirect(303, "../"+strconv.Itoa(id))
+	})
+
+	feedsGroup.POST("/snooze", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		until, err := snoozeFromForm(ctx)
+		if err == nil {
+			err = rss.Storage.SnoozeFeed(id, until)
+		}
+		if err != nil {
+			// Keeps the card in place so the snooze can be corrected.
+			var finalHTML = bytes.NewBufferString(errorAlert(err))
+			feedCardTemplate.Execute(finalHTML, buildFeedCardData(rss, id, rss.Storage.GetFeedByID(id)))
+			ctx.Data(http.StatusOK, "text/html", finalHTML.Bytes())
+			return
+		}
+		ctx.Redirect(303, "../"+strconv.Itoa(id))
+	})
+
+	feedsGroup.POST("/resume", func(ctx *gin.Context) {
+		var id = ctx.GetInt("ID")
+		var err = rss.Storage.ResumeFeed(id)
+		if err != nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
+		ctx.Redirect(303, "../"+strconv.Itoa(id))
 	})
 
 	feedsGroup.DELETE("/", func(ctx *gin.Context) {
 		var id = ctx.GetInt("ID")
-		rss.Storage.RemoveFeedByID(id)
+		var err = rss.Storage.RemoveFeedByID(id)
+		if err != nil {
+			ctx.Data(http.StatusOK, "text/html", []byte(errorAlert(err)))
+			return
+		}
 		ctx.Data(http.StatusOK, "text/html", []byte(""))
 	})
 }
+
+// Largest body accepted by a webhook.
+const maxWebhookBody = 1 << 20
+
+// Largest request accepted with an uploaded file, such as an OPML file or a backup.
+const maxUploadSize = 10 << 20
+
+var errUploadTooLarge = fmt.Errorf("the file is larger than the limit of %d MB", maxUploadSize>>20)
+
+// Uploads that are too large are answered with 413 Request Entity Too Large, other failures with the form showing the error.
+func uploadErrorStatus(err error) int {
+	if errors.Is(err, errUploadTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusOK
+}
+
+// Edits that are refused change nothing and are answered with a status saying why, along with the error to show.
+func editErrorStatus(err error) int {
+	var saveError storage.SaveError
+	var loadError storage.LoadError
+	switch {
+	case errors.Is(err, storage.ErrFeedNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &saveError), errors.As(err, &loadError):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+func webhookPath(id int, token string) string {
+	return "hooks/" + strconv.Itoa(id) + "/" + token
+}
+
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrFeedNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, rssreader.ErrWebhookUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, rssreader.ErrFeedPaused):
+		return http.StatusConflict
+	case errors.Is(err, rssreader.ErrInvalidPayload):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Reads the mapping and signature of a webhook feed. The token is left blank.
+func webhookSourceFromForm(ctx *gin.Context) (*storage.WebhookSource, error) {
+	var source = &storage.WebhookSource{
+		Secret:          strings.TrimSpace(ctx.PostForm("webhook-secret")),
+		SignatureHeader: strings.TrimSpace(ctx.PostForm("signature-header")),
+		Mapping: storage.WebhookMapping{
+			Items:       strings.TrimSpace(ctx.PostForm("map-items")),
+			Title:       strings.TrimSpace(ctx.PostForm("map-title")),
+			Description: strings.TrimSpace(ctx.PostForm("map-description")),
+			Link:        strings.TrimSpace(ctx.PostForm("map-link")),
+			ID:          strings.TrimSpace(ctx.PostForm("map-id")),
+			Published:   strings.TrimSpace(ctx.PostForm("map-published")),
+			Author:      strings.TrimSpace(ctx.PostForm("map-author")),
+		},
+	}
+	if len(source.Mapping.Title) == 0 && len(source.Mapping.Description) == 0 {
+		return source, errors.New("map at least a title or a message")
+	}
+	return source, nil
+}
+
+// Reads the whole of a file uploaded with the form.
+func uploadedFile(ctx *gin.Context, field string) ([]byte, error) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxUploadSize)
+	if err := ctx.Request.ParseMultipartForm(maxUploadSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errUploadTooLarge
+		}
+		return nil, errors.New("no file was uploaded")
+	}
+	fileHeader, err := ctx.FormFile(field)
+	if err != nil {
+		return nil, errors.New("no file was uploaded")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// Parses a template that may use the shared partial templates.
+func parseWithPartials(body string) (*template.Template, error) {
+	tmpl, err := template.New("").Parse(backlogFieldsBody)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmpl.Parse(feedSettingsFieldsBody)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmpl.Parse(logFilterFieldsBody)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmpl.Parse(webhookFieldsBody)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tmpl.Parse(targetResultBody)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(body)
+}
+
+// Renders a static card body that uses the shared partial templates.
+func renderPartial(body string, data any) (template.HTML, error) {
+	tmpl, err := parseWithPartials(body)
+	if err != nil {
+		return "", err
+	}
+	var rendered = new(bytes.Buffer)
+	err = tmpl.Execute(rendered, data)
+	return template.HTML(rendered.String()), err
+}
+
+func sortedFeedIDs(feeds map[int]*storage.Feed) []int {
+	var ids = []int{}
+	for id := range feeds {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func sortedGroupNames(groups map[string]*storage.Group) []string {
+	var names = []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Renders an error to be shown in place of what was being swapped in.
+func errorAlert(err error) string {
+	return `<div class="alert alert-danger">` + template.HTMLEscapeString(err.Error()) + `</div>`
+}
+
+// Renders what a manual check found.
+func summaryAlert(summary rssreader.PollSummary) string {
+	var class = "alert-info"
+	if len(summary.Errors) != 0 {
+		class = "alert-warning"
+	}
+	var html = `<div class="alert ` + class + ` p-2 my-2">` + template.HTMLEscapeString(summary.String())
+	for _, summaryError := range summary.Errors {
+		html += `<div>` + template.HTMLEscapeString(summaryError) + `</div>`
+	}
+	return html + `</div>`
+}
+
+func buildFeedCardData(rss *rssreader.RSS_Reader, id int, feed *storage.Feed) feedCardData {
+	var cardData = feedCardData{
+		Id:        id,
+		Url:       feed.Url,
+		Title:     feed.Name(),
+		Descript:  feed.Meta.Description,
+		SiteLink:  feed.Meta.SiteLink,
+		Icon:      feed.Meta.Icon,
+		ItemCount: feed.Meta.ItemCount,
+	}
+	if feed.Webhook != nil {
+		cardData.Webhook = webhookPath(id, feed.Webhook.Token)
+		cardData.Signed = len(feed.Webhook.Secret) != 0
+	}
+	if !feed.Meta.UpdatedAt.IsZero() {
+		cardData.MetaAge = time.Since(feed.Meta.UpdatedAt).Round(time.Second).String()
+	}
+
+	if feed.LastDate != nil {
+		cardData.LastFound = feed.LastDate.Round(time.Second).String()
+		cardData.TimeSince = time.Since(*feed.LastDate).Round(time.Second).String()
+	}
+
+	cardData.Group = feed.Group
+	cardData.Groups = sortedGroupNames(rss.Storage.GetGroups())
+	cardData.Tags = feed.Tags
+	cardData.TagList = strings.Join(feed.Tags, ", ")
+	cardData.Effective = rss.EffectiveSettings(feed)
+	cardData.AppTarget = "This plugin"
+	if token := cardData.Effective.AppToken.Value; len(token) > 4 {
+		cardData.AppTarget = "Token ending in " + token[len(token)-4:]
+	} else if len(token) != 0 {
+		cardData.AppTarget = "Custom token"
+	}
+	cardData.Overrides = settingsValues(feed.Settings)
+	cardData.Failures = feed.Failures
+	cardData.LastError = feed.LastError
+	if feed.LastErrorAt != nil {
+		cardData.LastErrorAge = time.Since(*feed.LastErrorAt).Round(time.Second).String()
+	}
+	if feed.LastSuccess != nil {
+		cardData.LastSuccessAge = time.Since(*feed.LastSuccess).Round(time.Second).String()
+	}
+	cardData.Targets = targetRows(feed.Targets)
+	cardData.TargetsOnly = !feed.SendsToGotify()
+	cardData.Paused = feed.Paused
+	cardData.PauseReason = feed.PauseReason
+	if feed.IsSnoozed(time.Now()) {
+		cardData.Snoozed = true
+		cardData.SnoozedUntil = feed.SnoozedUntil.Local().Format("2006-01-02 15:04")
+		cardData.SnoozeEnds = feed.SnoozedUntil.Unix()
+		cardData.SnoozeLeft = time.Until(*feed.SnoozedUntil).Round(time.Second).String()
+	}
+	return cardData
+}
+
+func targetRows(targets []storage.Target) []targetRow {
+	var rows = []targetRow{}
+	for _, target := range targets {
+		var row = targetRow{Target: target, Label: target.Label()}
+		var names = []string{}
+		for name := range target.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		row.HeaderNames = strings.Join(names, ", ")
+		if target.Last != nil {
+			row.LastAge = time.Since(target.Last.At).Round(time.Second).String()
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Reads headers given one per line as "Name: value".
+func headersFromForm(text string) (map[string]string, error) {
+	var headers = map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found || len(strings.TrimSpace(name)) == 0 {
+			return nil, fmt.Errorf("header %q is not of the form Name: value", line)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// The title of a feed in exported files. Blank when the feed has no title of its own.
+func feedExportTitle(feed *storage.Feed) string {
+	if len(feed.DisplayName) != 0 {
+		return feed.DisplayName
+	}
+	return feed.Meta.Title
+}
+
+// Reads an optional non negative number from the form. Nil when the field is left blank.
+func optionalIntFromForm(ctx *gin.Context, field string) (*int, error) {
+	var value = ctx.PostForm(field)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return nil, fmt.Errorf("invalid value for %s: %q", field, value)
+	}
+	return &number, nil
+}
+
+func settingsValues(settings storage.FeedSettings) feedSettingsValues {
+	var values = feedSettingsValues{}
+	if settings.PollMinutes != nil {
+		values.PollMinutes = strconv.Itoa(*settings.PollMinutes)
+	}
+	if settings.Priority != nil {
+		values.Priority = strconv.Itoa(*settings.Priority)
+	}
+	if settings.MaxItemsPerPoll != nil {
+		values.MaxItems = strconv.Itoa(*settings.MaxItemsPerPoll)
+	}
+	if settings.AppToken != nil {
+		values.AppToken = *settings.AppToken
+	}
+	return values
+}
+
+// Reads the settings a group or feed overrides. Blank fields are inherited.
+func feedSettingsFromForm(ctx *gin.Context) (storage.FeedSettings, error) {
+	var settings = storage.FeedSettings{}
+	var err error
+	settings.PollMinutes, err = optionalIntFromForm(ctx, "poll-minutes")
+	if err != nil {
+		return settings, err
+	}
+	if settings.PollMinutes != nil && *settings.PollMinutes < 1 {
+		return settings, fmt.Errorf("invalid value for poll-minutes: %q", ctx.PostForm("poll-minutes"))
+	}
+	settings.Priority, err = optionalIntFromForm(ctx, "priority")
+	if err != nil {
+		return settings, err
+	}
+	settings.MaxItemsPerPoll, err = optionalIntFromForm(ctx, "max-items")
+	if err != nil {
+		return settings, err
+	}
+	if token := strings.TrimSpace(ctx.PostForm("app-token")); len(token) != 0 {
+		settings.AppToken = &token
+	}
+	return settings, nil
+}
+
+// Reads when a snooze ends, either as a duration from now or as a local date and time.
+func snoozeFromForm(ctx *gin.Context) (time.Time, error) {
+	if snoozeFor := ctx.PostForm("snooze-for"); len(snoozeFor) != 0 {
+		duration, err := time.ParseDuration(snoozeFor)
+		if err != nil || duration <= 0 {
+			return time.Time{}, fmt.Errorf("invalid snooze duration: %q", snoozeFor)
+		}
+		return time.Now().Add(duration), nil
+	}
+	until, err := time.ParseInLocation("2006-01-02T15:04", ctx.PostForm("snooze-until"), time.Local)
+	if err != nil {
+		return until, fmt.Errorf("invalid snooze time: %q", ctx.PostForm("snooze-until"))
+	}
+	if !until.After(time.Now()) {
+		return until, errors.New("the snooze has to end in the future")
+	}
+	return until, nil
+}
+
+// Reads the backlog policy chosen when subscribing to a feed.
+func backlogFromForm(ctx *gin.Context) (storage.BacklogPolicy, error) {
+	var policy = storage.BacklogPolicy{Mode: ctx.DefaultPostForm("backlog-mode", storage.BacklogNone)}
+	switch policy.Mode {
+	case storage.BacklogNone, storage.BacklogAll:
+	case storage.BacklogLatest:
+		count, err := strconv.Atoi(ctx.PostForm("backlog-count"))
+		if err != nil || count < 1 {
+			return policy, fmt.Errorf("invalid number of latest items: %q", ctx.PostForm("backlog-count"))
+		}
+		policy.Count = count
+	case storage.BacklogSince:
+		since, err := time.ParseInLocation("2006-01-02", ctx.PostForm("backlog-since"), time.Local)
+		if err != nil {
+			return policy, fmt.Errorf("invalid date: %q", ctx.PostForm("backlog-since"))
+		}
+		policy.Since = &since
+	default:
+		return policy, fmt.Errorf("unknown backlog option: %q", policy.Mode)
+	}
+	return policy, nil
+}
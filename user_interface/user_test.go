@@ -0,0 +1,49 @@
+package user_interface
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CEKlopfenstein/simple-feeds/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func uploadRequest(content []byte) (*gin.Context, *httptest.ResponseRecorder) {
+	var body = new(bytes.Buffer)
+	var form = multipart.NewWriter(body)
+	file, _ := form.CreateFormFile("opml-file", "feeds.opml")
+	file.Write(content)
+	form.Close()
+	var recorder = httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/opml", body)
+	ctx.Request.Header.Set("Content-Type", form.FormDataContentType())
+	return ctx, recorder
+}
+
+func TestUploadedFileIsLimited(t *testing.T) {
+	ctx, _ := uploadRequest([]byte("<opml/>"))
+	content, err := uploadedFile(ctx, "opml-file")
+	assert.NoError(t, err)
+	assert.Equal(t, "<opml/>", string(content))
+
+	ctx, _ = uploadRequest(make([]byte, maxUploadSize))
+	_, err = uploadedFile(ctx, "opml-file")
+	assert.ErrorIs(t, err, errUploadTooLarge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, uploadErrorStatus(err))
+
+	ctx, _ = uploadRequest([]byte("<opml/>"))
+	_, err = uploadedFile(ctx, "backup-file")
+	assert.EqualError(t, err, "no file was uploaded")
+}
+
+func TestEditErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, editErrorStatus(storage.ErrGroupNotFound))
+	assert.Equal(t, http.StatusNotFound, editErrorStatus(storage.ErrFeedNotFound))
+	assert.Equal(t, http.StatusInternalServerError, editErrorStatus(storage.SaveError{Err: errors.New("disk full")}))
+}